@@ -0,0 +1,165 @@
+// commands.go
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const serverVersion = "0.1.0"
+
+// clientState holds per-connection state threaded through command handlers:
+// the negotiated RESP protocol version, the raw connection and its shared
+// syncWriter (needed to lazily spin up a subscriber), and that subscriber
+// itself once the connection has issued any (P)SUBSCRIBE.
+type clientState struct {
+	proto int // 2 or 3, set via HELLO; defaults to 2
+	conn  net.Conn
+	sw    *syncWriter
+	sub   *subscriber
+}
+
+// commandFunc executes one command against db and writes its reply to w.
+// It only returns an error for write/flush failures on the connection;
+// client-visible errors (bad arity, wrong type, ...) are written as RESP
+// errors and return nil.
+type commandFunc func(db *DB, cs *clientState, w *respWriter, args []string) error
+
+// commandTable routes dispatch by uppercase command name so new commands
+// can register themselves here without touching handleConn.
+var commandTable = map[string]commandFunc{
+	"PING":         cmdPing,
+	"HELLO":        cmdHello,
+	"SET":          cmdSet,
+	"GET":          cmdGet,
+	"DEL":          cmdDel,
+	"SAVE":         cmdSave,
+	"BGSAVE":       cmdBGSave,
+	"BGREWRITEAOF": cmdBGRewriteAOF,
+
+	"LPUSH":  cmdLPush,
+	"RPUSH":  cmdRPush,
+	"LPOP":   cmdLPop,
+	"RPOP":   cmdRPop,
+	"LRANGE": cmdLRange,
+	"LLEN":   cmdLLen,
+
+	"HSET":    cmdHSet,
+	"HGET":    cmdHGet,
+	"HDEL":    cmdHDel,
+	"HGETALL": cmdHGetAll,
+	"HLEN":    cmdHLen,
+
+	"SADD":      cmdSAdd,
+	"SREM":      cmdSRem,
+	"SISMEMBER": cmdSIsMember,
+	"SMEMBERS":  cmdSMembers,
+	"SCARD":     cmdSCard,
+
+	"ZADD":          cmdZAdd,
+	"ZREM":          cmdZRem,
+	"ZSCORE":        cmdZScore,
+	"ZRANGE":        cmdZRange,
+	"ZRANGEBYSCORE": cmdZRangeByScore,
+
+	"SUBSCRIBE":    cmdSubscribe,
+	"UNSUBSCRIBE":  cmdUnsubscribe,
+	"PSUBSCRIBE":   cmdPSubscribe,
+	"PUNSUBSCRIBE": cmdPUnsubscribe,
+	"PUBLISH":      cmdPublish,
+}
+
+func cmdPing(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if len(args) > 1 {
+		return w.WriteBulkString([]byte(args[1]))
+	}
+	return w.WriteSimpleString("PONG")
+}
+
+// cmdHello implements the RESP3 upgrade handshake: `HELLO [protover]`
+// switches the connection's reply encoding and responds with a map of
+// server/version/proto fields.
+func cmdHello(db *DB, cs *clientState, w *respWriter, args []string) error {
+	proto := cs.proto
+	if len(args) > 1 {
+		p, err := strconv.Atoi(args[1])
+		if err != nil || (p != 2 && p != 3) {
+			return w.WriteError("NOPROTO unsupported protocol version")
+		}
+		proto = p
+	}
+	cs.proto = proto
+	pairs := [][2]string{
+		{"server", "redisgo"},
+		{"version", serverVersion},
+		{"proto", strconv.Itoa(proto)},
+	}
+	return w.WriteMap(pairs, proto)
+}
+
+func cmdSet(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if db.readOnly {
+		return w.WriteError("READONLY You can't write against a read only replica.")
+	}
+	if len(args) < 3 {
+		return w.WriteError("ERR wrong number of arguments for 'set' command")
+	}
+	key := args[1]
+	val := []byte(args[2])
+	var ttl time.Duration
+	if len(args) >= 5 && strings.ToUpper(args[3]) == "PX" {
+		ms, err := strconv.ParseInt(args[4], 10, 64)
+		if err != nil {
+			return w.WriteError("ERR value is not an integer or out of range")
+		}
+		ttl = time.Duration(ms) * time.Millisecond
+	}
+	if err := db.Set(key, val, ttl); err != nil {
+		return w.WriteError("ERR " + err.Error())
+	}
+	return w.WriteSimpleString("OK")
+}
+
+func cmdGet(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if len(args) != 2 {
+		return w.WriteError("ERR wrong number of arguments for 'get' command")
+	}
+	v, ok, err := db.Get(args[1])
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	if !ok {
+		return w.WriteNilBulk()
+	}
+	return w.WriteBulkString(v)
+}
+
+func cmdDel(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if db.readOnly {
+		return w.WriteError("READONLY You can't write against a read only replica.")
+	}
+	if len(args) < 2 {
+		return w.WriteError("ERR wrong number of arguments for 'del' command")
+	}
+	removed := db.Del(args[1:]...)
+	return w.WriteInteger(int64(removed))
+}
+
+func cmdSave(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if err := db.SaveSnapshot(); err != nil {
+		return w.WriteError("ERR " + err.Error())
+	}
+	return w.WriteSimpleString("OK")
+}
+
+func cmdBGSave(db *DB, cs *clientState, w *respWriter, args []string) error {
+	db.BGSave()
+	return w.WriteSimpleString("Background saving started")
+}
+
+func cmdBGRewriteAOF(db *DB, cs *clientState, w *respWriter, args []string) error {
+	db.BGRewriteAOF()
+	return w.WriteSimpleString("Background append only file rewriting started")
+}
@@ -0,0 +1,129 @@
+// datatypes_test.go
+package main
+
+import "testing"
+
+func TestListPushPopRange(t *testing.T) {
+	db := newTestDB(t)
+
+	if n, err := db.RPush("l", []byte("a"), []byte("b")); err != nil || n != 2 {
+		t.Fatalf("rpush: n=%d err=%v", n, err)
+	}
+	if n, err := db.LPush("l", []byte("z")); err != nil || n != 3 {
+		t.Fatalf("lpush: n=%d err=%v", n, err)
+	}
+
+	items, err := db.LRange("l", 0, -1)
+	if err != nil {
+		t.Fatalf("lrange: %v", err)
+	}
+	want := []string{"z", "a", "b"}
+	if len(items) != len(want) {
+		t.Fatalf("lrange = %v, want %v", items, want)
+	}
+	for i, w := range want {
+		if string(items[i]) != w {
+			t.Fatalf("lrange[%d] = %q, want %q", i, items[i], w)
+		}
+	}
+
+	if v, ok, err := db.LPop("l"); err != nil || !ok || string(v) != "z" {
+		t.Fatalf("lpop = %q, %v, %v", v, ok, err)
+	}
+	if v, ok, err := db.RPop("l"); err != nil || !ok || string(v) != "b" {
+		t.Fatalf("rpop = %q, %v, %v", v, ok, err)
+	}
+	if n, err := db.LLen("l"); err != nil || n != 1 {
+		t.Fatalf("llen = %d, %v", n, err)
+	}
+
+	if err := db.Set("str", []byte("x"), 0); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if _, err := db.LRange("str", 0, -1); err != errWrongType {
+		t.Fatalf("lrange against string: got %v, want errWrongType", err)
+	}
+}
+
+func TestHashSetGetDel(t *testing.T) {
+	db := newTestDB(t)
+
+	n, err := db.HSet("h", map[string][]byte{"f1": []byte("v1"), "f2": []byte("v2")})
+	if err != nil || n != 2 {
+		t.Fatalf("hset: n=%d err=%v", n, err)
+	}
+	if v, ok, err := db.HGet("h", "f1"); err != nil || !ok || string(v) != "v1" {
+		t.Fatalf("hget f1 = %q, %v, %v", v, ok, err)
+	}
+	if l, err := db.HLen("h"); err != nil || l != 2 {
+		t.Fatalf("hlen = %d, %v", l, err)
+	}
+	if removed, err := db.HDel("h", "f1"); err != nil || removed != 1 {
+		t.Fatalf("hdel: removed=%d err=%v", removed, err)
+	}
+	if _, ok, _ := db.HGet("h", "f1"); ok {
+		t.Fatalf("f1 should be gone after hdel")
+	}
+}
+
+func TestSetAddRemIsMember(t *testing.T) {
+	db := newTestDB(t)
+
+	if n, err := db.SAdd("s", "a", "b", "a"); err != nil || n != 2 {
+		t.Fatalf("sadd: n=%d err=%v", n, err)
+	}
+	if ok, err := db.SIsMember("s", "a"); err != nil || !ok {
+		t.Fatalf("sismember a = %v, %v", ok, err)
+	}
+	if n, err := db.SCard("s"); err != nil || n != 2 {
+		t.Fatalf("scard = %d, %v", n, err)
+	}
+	if n, err := db.SRem("s", "a"); err != nil || n != 1 {
+		t.Fatalf("srem: n=%d err=%v", n, err)
+	}
+	if ok, err := db.SIsMember("s", "a"); err != nil || ok {
+		t.Fatalf("sismember a after srem = %v, %v", ok, err)
+	}
+}
+
+func TestZSetAddRangeScore(t *testing.T) {
+	db := newTestDB(t)
+
+	members := []ZMember{{Member: "a", Score: 3}, {Member: "b", Score: 1}, {Member: "c", Score: 2}}
+	if n, err := db.ZAdd("z", members...); err != nil || n != 3 {
+		t.Fatalf("zadd: n=%d err=%v", n, err)
+	}
+
+	ranked, err := db.ZRange("z", 0, -1)
+	if err != nil {
+		t.Fatalf("zrange: %v", err)
+	}
+	want := []string{"b", "c", "a"} // ordered by score ascending
+	if len(ranked) != len(want) {
+		t.Fatalf("zrange = %v, want members %v", ranked, want)
+	}
+	for i, w := range want {
+		if ranked[i].Member != w {
+			t.Fatalf("zrange[%d] = %q, want %q", i, ranked[i].Member, w)
+		}
+	}
+
+	if score, ok, err := db.ZScore("z", "c"); err != nil || !ok || score != 2 {
+		t.Fatalf("zscore c = %v, %v, %v", score, ok, err)
+	}
+
+	inRange, err := db.ZRangeByScore("z", 1, 2)
+	if err != nil {
+		t.Fatalf("zrangebyscore: %v", err)
+	}
+	if len(inRange) != 2 || inRange[0].Member != "b" || inRange[1].Member != "c" {
+		t.Fatalf("zrangebyscore(1,2) = %v", inRange)
+	}
+
+	if n, err := db.ZRem("z", "b"); err != nil || n != 1 {
+		t.Fatalf("zrem: n=%d err=%v", n, err)
+	}
+	if _, ok, err := db.ZScore("z", "b"); err != nil || ok {
+		t.Fatalf("zscore b after zrem: ok=%v err=%v", ok, err)
+	}
+}
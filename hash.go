@@ -0,0 +1,210 @@
+// hash.go
+package main
+
+import "github.com/sirdesai22/redisgo/rdb"
+
+func (sh *shard) hsetLocked(key string, fields map[string][]byte) (int, error) {
+	e, err := sh.getOrCreateLocked(key, rdb.TypeHash, func() *entry {
+		return &entry{Type: rdb.TypeHash, Hash: make(map[string][]byte)}
+	})
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for f, v := range fields {
+		if _, exists := e.Hash[f]; !exists {
+			added++
+		}
+		e.Hash[f] = v
+	}
+	return added, nil
+}
+
+func (sh *shard) hdelLocked(key string, fields []string) (int, error) {
+	e, ok := sh.data[key]
+	if !ok {
+		return 0, nil
+	}
+	if e.Type != rdb.TypeHash {
+		return 0, errWrongType
+	}
+	removed := 0
+	for _, f := range fields {
+		if _, exists := e.Hash[f]; exists {
+			delete(e.Hash, f)
+			removed++
+		}
+	}
+	if len(e.Hash) == 0 {
+		delete(sh.data, key)
+	}
+	return removed, nil
+}
+
+// HSet sets fields in key's hash (creating it if absent) and returns the
+// number of fields that were newly created.
+func (db *DB) HSet(key string, fields map[string][]byte) (int, error) {
+	args := []string{"HSET", key}
+	for f, v := range fields {
+		args = append(args, f, string(v))
+	}
+	raw := encodeCommand(args)
+
+	sh := db.store.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	n, err := sh.hsetLocked(key, fields)
+	if err != nil {
+		return 0, err
+	}
+	return n, db.logAndPropagate(raw)
+}
+
+// HGet returns the value of field in key's hash.
+func (db *DB) HGet(key, field string) ([]byte, bool, error) {
+	sh := db.store.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	e, ok := sh.data[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if e.Type != rdb.TypeHash {
+		return nil, false, errWrongType
+	}
+	v, ok := e.Hash[field]
+	return v, ok, nil
+}
+
+// HDel removes fields from key's hash.
+func (db *DB) HDel(key string, fields ...string) (int, error) {
+	raw := encodeCommand(append([]string{"HDEL", key}, fields...))
+
+	sh := db.store.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	n, err := sh.hdelLocked(key, fields)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	return n, db.logAndPropagate(raw)
+}
+
+// HGetAll returns a copy of key's hash.
+func (db *DB) HGetAll(key string) (map[string][]byte, error) {
+	sh := db.store.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	e, ok := sh.data[key]
+	if !ok {
+		return nil, nil
+	}
+	if e.Type != rdb.TypeHash {
+		return nil, errWrongType
+	}
+	out := make(map[string][]byte, len(e.Hash))
+	for k, v := range e.Hash {
+		out[k] = v
+	}
+	return out, nil
+}
+
+// HLen returns the number of fields in key's hash.
+func (db *DB) HLen(key string) (int, error) {
+	sh := db.store.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	e, ok := sh.data[key]
+	if !ok {
+		return 0, nil
+	}
+	if e.Type != rdb.TypeHash {
+		return 0, errWrongType
+	}
+	return len(e.Hash), nil
+}
+
+// pairsToFields turns a flat [field1 value1 field2 value2 ...] argument
+// list into a field->value map, as used by HSET.
+func pairsToFields(pairs []string) map[string][]byte {
+	fields := make(map[string][]byte, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		fields[pairs[i]] = []byte(pairs[i+1])
+	}
+	return fields
+}
+
+func cmdHSet(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if db.readOnly {
+		return w.WriteError("READONLY You can't write against a read only replica.")
+	}
+	if len(args) < 4 || len(args)%2 != 0 {
+		return w.WriteError("ERR wrong number of arguments for 'hset' command")
+	}
+	n, err := db.HSet(args[1], pairsToFields(args[2:]))
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	return w.WriteInteger(int64(n))
+}
+
+func cmdHGet(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if len(args) != 3 {
+		return w.WriteError("ERR wrong number of arguments for 'hget' command")
+	}
+	v, ok, err := db.HGet(args[1], args[2])
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	if !ok {
+		return w.WriteNilBulk()
+	}
+	return w.WriteBulkString(v)
+}
+
+func cmdHDel(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if db.readOnly {
+		return w.WriteError("READONLY You can't write against a read only replica.")
+	}
+	if len(args) < 3 {
+		return w.WriteError("ERR wrong number of arguments for 'hdel' command")
+	}
+	n, err := db.HDel(args[1], args[2:]...)
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	return w.WriteInteger(int64(n))
+}
+
+func cmdHGetAll(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if len(args) != 2 {
+		return w.WriteError("ERR wrong number of arguments for 'hgetall' command")
+	}
+	fields, err := db.HGetAll(args[1])
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	if err := w.WriteArrayHeader(len(fields) * 2); err != nil {
+		return err
+	}
+	for f, v := range fields {
+		if err := w.WriteBulkString([]byte(f)); err != nil {
+			return err
+		}
+		if err := w.WriteBulkString(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdHLen(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if len(args) != 2 {
+		return w.WriteError("ERR wrong number of arguments for 'hlen' command")
+	}
+	n, err := db.HLen(args[1])
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	return w.WriteInteger(int64(n))
+}
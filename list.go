@@ -0,0 +1,270 @@
+// list.go
+package main
+
+import (
+	"container/list"
+
+	"github.com/sirdesai22/redisgo/rdb"
+)
+
+func (sh *shard) lpushLocked(key string, values [][]byte) (int, error) {
+	e, err := sh.getOrCreateLocked(key, rdb.TypeList, func() *entry {
+		return &entry{Type: rdb.TypeList, List: list.New()}
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range values {
+		e.List.PushFront(v)
+	}
+	return e.List.Len(), nil
+}
+
+func (sh *shard) rpushLocked(key string, values [][]byte) (int, error) {
+	e, err := sh.getOrCreateLocked(key, rdb.TypeList, func() *entry {
+		return &entry{Type: rdb.TypeList, List: list.New()}
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range values {
+		e.List.PushBack(v)
+	}
+	return e.List.Len(), nil
+}
+
+func (sh *shard) lpopLocked(key string) ([]byte, bool, error) {
+	e, ok := sh.data[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if e.Type != rdb.TypeList {
+		return nil, false, errWrongType
+	}
+	front := e.List.Front()
+	if front == nil {
+		return nil, false, nil
+	}
+	e.List.Remove(front)
+	if e.List.Len() == 0 {
+		delete(sh.data, key)
+	}
+	return front.Value.([]byte), true, nil
+}
+
+func (sh *shard) rpopLocked(key string) ([]byte, bool, error) {
+	e, ok := sh.data[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if e.Type != rdb.TypeList {
+		return nil, false, errWrongType
+	}
+	back := e.List.Back()
+	if back == nil {
+		return nil, false, nil
+	}
+	e.List.Remove(back)
+	if e.List.Len() == 0 {
+		delete(sh.data, key)
+	}
+	return back.Value.([]byte), true, nil
+}
+
+// LPush pushes values onto the head of key's list (creating it if absent)
+// and appends the equivalent command to the AOF.
+func (db *DB) LPush(key string, values ...[]byte) (int, error) {
+	raw := encodeCommand(append([]string{"LPUSH", key}, bytesToStrings(values)...))
+
+	sh := db.store.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	n, err := sh.lpushLocked(key, values)
+	if err != nil {
+		return 0, err
+	}
+	return n, db.logAndPropagate(raw)
+}
+
+// RPush pushes values onto the tail of key's list (creating it if absent)
+// and appends the equivalent command to the AOF.
+func (db *DB) RPush(key string, values ...[]byte) (int, error) {
+	raw := encodeCommand(append([]string{"RPUSH", key}, bytesToStrings(values)...))
+
+	sh := db.store.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	n, err := sh.rpushLocked(key, values)
+	if err != nil {
+		return 0, err
+	}
+	return n, db.logAndPropagate(raw)
+}
+
+// LPop removes and returns the head of key's list.
+func (db *DB) LPop(key string) ([]byte, bool, error) {
+	raw := encodeCommand([]string{"LPOP", key})
+
+	sh := db.store.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	v, ok, err := sh.lpopLocked(key)
+	if err != nil || !ok {
+		return v, ok, err
+	}
+	return v, ok, db.logAndPropagate(raw)
+}
+
+// RPop removes and returns the tail of key's list.
+func (db *DB) RPop(key string) ([]byte, bool, error) {
+	raw := encodeCommand([]string{"RPOP", key})
+
+	sh := db.store.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	v, ok, err := sh.rpopLocked(key)
+	if err != nil || !ok {
+		return v, ok, err
+	}
+	return v, ok, db.logAndPropagate(raw)
+}
+
+// LRange returns the elements of key's list between start and stop
+// (inclusive, negative indices count from the end).
+func (db *DB) LRange(key string, start, stop int) ([][]byte, error) {
+	sh := db.store.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	e, ok := sh.data[key]
+	if !ok {
+		return nil, nil
+	}
+	if e.Type != rdb.TypeList {
+		return nil, errWrongType
+	}
+	n := e.List.Len()
+	start, stop = normalizeRange(start, stop, n)
+	if start > stop {
+		return nil, nil
+	}
+	out := make([][]byte, 0, stop-start+1)
+	i := 0
+	for node := e.List.Front(); node != nil && i <= stop; node, i = node.Next(), i+1 {
+		if i >= start {
+			out = append(out, node.Value.([]byte))
+		}
+	}
+	return out, nil
+}
+
+// LLen returns the length of key's list.
+func (db *DB) LLen(key string) (int, error) {
+	sh := db.store.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	e, ok := sh.data[key]
+	if !ok {
+		return 0, nil
+	}
+	if e.Type != rdb.TypeList {
+		return 0, errWrongType
+	}
+	return e.List.Len(), nil
+}
+
+func cmdLPush(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if db.readOnly {
+		return w.WriteError("READONLY You can't write against a read only replica.")
+	}
+	if len(args) < 3 {
+		return w.WriteError("ERR wrong number of arguments for 'lpush' command")
+	}
+	n, err := db.LPush(args[1], stringsToBytes(args[2:])...)
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	return w.WriteInteger(int64(n))
+}
+
+func cmdRPush(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if db.readOnly {
+		return w.WriteError("READONLY You can't write against a read only replica.")
+	}
+	if len(args) < 3 {
+		return w.WriteError("ERR wrong number of arguments for 'rpush' command")
+	}
+	n, err := db.RPush(args[1], stringsToBytes(args[2:])...)
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	return w.WriteInteger(int64(n))
+}
+
+func cmdLPop(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if db.readOnly {
+		return w.WriteError("READONLY You can't write against a read only replica.")
+	}
+	if len(args) != 2 {
+		return w.WriteError("ERR wrong number of arguments for 'lpop' command")
+	}
+	v, ok, err := db.LPop(args[1])
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	if !ok {
+		return w.WriteNilBulk()
+	}
+	return w.WriteBulkString(v)
+}
+
+func cmdRPop(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if db.readOnly {
+		return w.WriteError("READONLY You can't write against a read only replica.")
+	}
+	if len(args) != 2 {
+		return w.WriteError("ERR wrong number of arguments for 'rpop' command")
+	}
+	v, ok, err := db.RPop(args[1])
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	if !ok {
+		return w.WriteNilBulk()
+	}
+	return w.WriteBulkString(v)
+}
+
+func cmdLRange(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if len(args) != 4 {
+		return w.WriteError("ERR wrong number of arguments for 'lrange' command")
+	}
+	start, err1 := parseInt(args[2])
+	stop, err2 := parseInt(args[3])
+	if err1 != nil || err2 != nil {
+		return w.WriteError("ERR value is not an integer or out of range")
+	}
+	items, err := db.LRange(args[1], start, stop)
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	if err := w.WriteArrayHeader(len(items)); err != nil {
+		return err
+	}
+	for _, v := range items {
+		if err := w.WriteBulkString(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdLLen(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if len(args) != 2 {
+		return w.WriteError("ERR wrong number of arguments for 'llen' command")
+	}
+	n, err := db.LLen(args[1])
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	return w.WriteInteger(int64(n))
+}
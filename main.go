@@ -2,273 +2,320 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
+	"container/list"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/sirdesai22/redisgo/rdb"
 )
 
 const (
-	ADDRESS   = "127.0.0.1:6380"
-	AOF_FILE  = "appendonly.aof"
-	SNAPSHOT  = "dump.rdb"
-	AOF_SYNC  = true // set false to buffer/faster but less durable
+	ADDRESS     = "127.0.0.1:6380"
+	AOF_FILE    = "appendonly.aof"
+	SNAPSHOT    = "dump.rdb"
+	AOF_SYNC    = true // set false to buffer/faster but less durable
 	EXPIRY_TICK = 1 * time.Second
 )
 
+// entry is a tagged union over the value kinds a key can hold. Type is one
+// of the rdb.Type* tags, which double as the on-disk type byte so
+// persistence doesn't need a second enum; only the field matching Type is
+// populated.
 type entry struct {
-	Value     []byte
+	Type      byte
+	Str       []byte
+	List      *list.List        // TypeList; elements are []byte
+	Hash      map[string][]byte // TypeHash
+	Set       map[string]struct{}
+	ZSet      *zset
 	ExpiresAt time.Time // zero means no expiry
 }
 
+// errWrongType is returned by data-type operations run against a key that
+// holds a different type, mirroring Redis's -WRONGTYPE error.
+var errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
 type DB struct {
-	mu    sync.RWMutex
-	data  map[string]*entry
+	store *shardedStore
 	aof   *os.File
 	aofMu sync.Mutex
+
+	repl     *replState // replication state; this instance is always a potential master
+	readOnly bool       // true once started with --replicaof; rejects client writes
+
+	aofRewrite aofRewriteBuf // captures writes that race a BGREWRITEAOF
+
+	pubsub *pubSub // channel/pattern subscriptions, independent of the keyspace
 }
 
 func NewDB() (*DB, error) {
+	return NewDBWithShards(runtime.GOMAXPROCS(0))
+}
+
+// NewDBWithShards is NewDB with an explicit shard count, mainly so tests
+// and the benchmark harness can compare throughput across shard counts.
+func NewDBWithShards(numShards int) (*DB, error) {
 	f, err := os.OpenFile(AOF_FILE, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
 	if err != nil {
 		return nil, err
 	}
 	db := &DB{
-		data: make(map[string]*entry),
-		aof:  f,
+		store:  newShardedStore(numShards),
+		aof:    f,
+		repl:   newReplState(),
+		pubsub: newPubSub(),
 	}
 	if err := db.loadAOF(); err != nil {
 		return nil, err
 	}
-	go db.expiryWorker()
+	for _, sh := range db.store.shards {
+		go sh.expireLoop()
+	}
 	return db, nil
 }
 
+// setLocked applies a SET to sh; callers hold sh.mu. SET always overwrites
+// whatever type previously lived at key, matching Redis.
+func (sh *shard) setLocked(key string, value []byte, ttl time.Duration) {
+	ent := &entry{Type: rdb.TypeString, Str: value}
+	if ttl > 0 {
+		ent.ExpiresAt = time.Now().Add(ttl)
+	}
+	sh.data[key] = ent
+}
+
+// getOrCreateLocked fetches key's entry, creating it via create if absent,
+// and returns errWrongType if it exists with a different type. Callers
+// hold sh.mu for writing.
+func (sh *shard) getOrCreateLocked(key string, wantType byte, create func() *entry) (*entry, error) {
+	e, ok := sh.data[key]
+	if !ok {
+		e = create()
+		sh.data[key] = e
+		return e, nil
+	}
+	if e.Type != wantType {
+		return nil, errWrongType
+	}
+	return e, nil
+}
+
 // Basic commands
 func (db *DB) Set(key string, value []byte, ttl time.Duration) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-	ent := &entry{Value: value}
+	args := []string{"SET", key, string(value)}
 	if ttl > 0 {
-		ent.ExpiresAt = time.Now().Add(ttl)
+		args = append(args, "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
 	}
-	db.data[key] = ent
-	return db.appendAOF("SET", key, value, ttl)
+	raw := encodeCommand(args)
+
+	sh := db.store.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.setLocked(key, value, ttl)
+	return db.logAndPropagate(raw)
 }
 
-func (db *DB) Get(key string) ([]byte, bool) {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
-	e, ok := db.data[key]
-	if !ok || ( !e.ExpiresAt.IsZero() && time.Now().After(e.ExpiresAt)) {
-		return nil, false
+func (db *DB) Get(key string) ([]byte, bool, error) {
+	sh := db.store.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	e, ok := sh.data[key]
+	if !ok || (!e.ExpiresAt.IsZero() && time.Now().After(e.ExpiresAt)) {
+		return nil, false, nil
+	}
+	if e.Type != rdb.TypeString {
+		return nil, false, errWrongType
 	}
-	return e.Value, true
+	return e.Str, true, nil
 }
 
+// Del removes keys, grouping them by shard and locking each group in
+// stable shard-index order so a concurrent multi-key command over an
+// overlapping key set can never deadlock against this one. Every
+// group's lock is held until after the DEL record has been logged and
+// propagated, so a concurrent write to one of these keys can never log
+// out of order with this deletion.
 func (db *DB) Del(keys ...string) int {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+	groups := db.store.keysByShard(keys)
+	for _, g := range groups {
+		g.shard.mu.Lock()
+	}
+	defer func() {
+		for _, g := range groups {
+			g.shard.mu.Unlock()
+		}
+	}()
+
 	deleted := 0
-	for _, k := range keys {
-		if _, ok := db.data[k]; ok {
-			delete(db.data, k)
-			deleted++
-			// optionally record DEL in AOF
-			_ = db.appendAOF("DEL", k, nil, 0)
+	for _, g := range groups {
+		for _, k := range g.keys {
+			if _, ok := g.shard.data[k]; ok {
+				delete(g.shard.data, k)
+				deleted++
+			}
 		}
 	}
+	if deleted > 0 {
+		_ = db.logAndPropagate(encodeCommand(append([]string{"DEL"}, keys...)))
+	}
 	return deleted
 }
 
-func (db *DB) appendAOF(cmd, key string, value []byte, ttl time.Duration) error {
-	db.aofMu.Lock()
-	defer db.aofMu.Unlock()
-	// Store AOF as JSON lines for simplicity: {"cmd":"SET","key":"k","value":"base64","ttl_ms":123}
-	rec := map[string]interface{}{
-		"cmd": cmd,
-		"key": key,
-	}
-	if value != nil {
-		rec["value"] = string(value) // value is raw bytes; for binary, use base64
+// normalizeRange converts a Redis-style [start, stop] index pair (either of
+// which may be negative, counting from the end) into clamped, inclusive
+// bounds into a sequence of length n.
+func normalizeRange(start, stop, n int) (int, int) {
+	if start < 0 {
+		start += n
 	}
-	if ttl > 0 {
-		rec["ttl_ms"] = int64(ttl / time.Millisecond)
+	if stop < 0 {
+		stop += n
 	}
-	b, _ := json.Marshal(rec)
-	if _, err := db.aof.Write(append(b, '\n')); err != nil {
-		return err
+	if start < 0 {
+		start = 0
 	}
-	if AOF_SYNC {
-		return db.aof.Sync()
+	if stop >= n {
+		stop = n - 1
 	}
-	return nil
+	return start, stop
 }
 
-func (db *DB) loadAOF() error {
-	db.aofMu.Lock()
-	defer db.aofMu.Unlock()
-	_, err := db.aof.Seek(0, io.SeekStart)
-	if err != nil {
-		return err
-	}
-	scanner := bufio.NewScanner(db.aof)
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		var rec map[string]interface{}
-		if err := json.Unmarshal(line, &rec); err != nil {
-			continue // skip invalid line
-		}
-		cmd := strings.ToUpper(fmt.Sprintf("%v", rec["cmd"]))
-		key := fmt.Sprintf("%v", rec["key"])
-		switch cmd {
-		case "SET":
-			val := []byte(fmt.Sprintf("%v", rec["value"]))
-			var ttl time.Duration
-			if t, ok := rec["ttl_ms"]; ok {
-				if ms, ok2 := t.(float64); ok2 && ms > 0 {
-					ttl = time.Duration(int64(ms)) * time.Millisecond
-				}
-			}
-			db.data[key] = &entry{Value: val}
-			if ttl > 0 {
-				db.data[key].ExpiresAt = time.Now().Add(ttl)
-			}
-		case "DEL":
-			delete(db.data, key)
-		}
-	}
-	return nil
+// parseInt wraps strconv.Atoi for command handlers that accept a signed
+// index or count argument.
+func parseInt(s string) (int, error) {
+	return strconv.Atoi(s)
 }
 
-func (db *DB) expiryWorker() {
-	t := time.NewTicker(EXPIRY_TICK)
-	defer t.Stop()
-	for range t.C {
-		now := time.Now()
-		db.mu.Lock()
-		for k, e := range db.data {
-			if !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt) {
-				delete(db.data, k)
-			}
-		}
-		db.mu.Unlock()
+func bytesToStrings(bs [][]byte) []string {
+	ss := make([]string, len(bs))
+	for i, b := range bs {
+		ss[i] = string(b)
 	}
+	return ss
 }
 
-// Snapshotting (simple)
-func (db *DB) SaveSnapshot() error {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
-	tmp := make(map[string]map[string]interface{})
-	for k, e := range db.data {
-		ent := map[string]interface{}{
-			"value":     string(e.Value),
-			"expiresAt": e.ExpiresAt.UnixNano(),
-		}
-		tmp[k] = ent
-	}
-	b, err := json.MarshalIndent(tmp, "", "  ")
-	if err != nil {
-		return err
+func stringsToBytes(ss []string) [][]byte {
+	bs := make([][]byte, len(ss))
+	for i, s := range ss {
+		bs[i] = []byte(s)
 	}
-	return os.WriteFile(SNAPSHOT, b, 0644)
+	return bs
+}
+
+// handleConn serves one client connection using the RESP protocol: it reads
+// commands (array-of-bulk-strings, or inline as a fallback), dispatches them
+// through commandTable, and writes back replies. Pipelined requests are read
+// and answered in order without waiting for the client to flush between
+// them.
+// subscribeModeAllowed lists the commands a connection may still issue
+// once it has at least one active channel or pattern subscription; any
+// other command is rejected without being dispatched, matching Redis's
+// subscribed-mode restriction.
+var subscribeModeAllowed = map[string]bool{
+	"SUBSCRIBE":    true,
+	"UNSUBSCRIBE":  true,
+	"PSUBSCRIBE":   true,
+	"PUNSUBSCRIBE": true,
+	"PING":         true,
 }
 
-// TCP server and simple text protocol: commands are lines like:
-// SET key value [PX milliseconds]
-// GET key
-// DEL key [key...]
-// SAVE
-// PING
 func handleConn(conn net.Conn, db *DB) {
 	defer conn.Close()
-	r := bufio.NewReader(conn)
+	reader := newRESPReader(conn)
+	sw := &syncWriter{w: conn}
+	writer := newRESPWriter(sw)
+	cs := &clientState{proto: 2, conn: conn, sw: sw}
+	defer func() {
+		if cs.sub == nil {
+			return
+		}
+		cs.sub.mu.Lock()
+		channels := make([]string, 0, len(cs.sub.channels))
+		for ch := range cs.sub.channels {
+			channels = append(channels, ch)
+		}
+		patterns := make([]string, 0, len(cs.sub.patterns))
+		for p := range cs.sub.patterns {
+			patterns = append(patterns, p)
+		}
+		cs.sub.mu.Unlock()
+		for _, ch := range channels {
+			db.pubsub.unsubscribe(cs.sub, ch)
+		}
+		for _, p := range patterns {
+			db.pubsub.punsubscribe(cs.sub, p)
+		}
+		cs.sub.drop()
+	}()
 	for {
 		conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
-		line, err := r.ReadString('\n')
+		cmd, err := reader.ReadCommand()
 		if err != nil {
 			if err != io.EOF {
-				// fmt.Println("read err:", err)
+				writer.WriteError("ERR Protocol error: " + err.Error())
+				writer.Flush()
 			}
 			return
 		}
-		line = strings.TrimSpace(line)
-		if line == "" {
+		if len(cmd.Args) == 0 {
 			continue
 		}
-		args := splitArgs(line)
-		if len(args) == 0 {
-			io.WriteString(conn, "-ERR empty command\r\n")
-			continue
+		name := strings.ToUpper(cmd.Args[0])
+		if name == "QUIT" {
+			writer.WriteSimpleString("OK")
+			writer.Flush()
+			return
 		}
-		switch strings.ToUpper(args[0]) {
-		case "PING":
-			io.WriteString(conn, "+PONG\r\n")
-		case "SET":
-			if len(args) < 3 {
-				io.WriteString(conn, "-ERR wrong number of args for SET\r\n")
-				continue
-			}
-			key := args[1]
-			val := []byte(args[2])
-			var ttl time.Duration
-			if len(args) >= 5 && strings.ToUpper(args[3]) == "PX" {
-				if ms, err := time.ParseDuration(args[4] + "ms"); err == nil {
-					ttl = ms
-				}
-			}
-			if err := db.Set(key, val, ttl); err != nil {
-				io.WriteString(conn, "-ERR "+err.Error()+"\r\n")
-			} else {
-				io.WriteString(conn, "+OK\r\n")
-			}
-		case "GET":
-			if len(args) != 2 {
-				io.WriteString(conn, "-ERR wrong number of args for GET\r\n")
-				continue
-			}
-			if v, ok := db.Get(args[1]); ok {
-				io.WriteString(conn, fmt.Sprintf("$%d\r\n%s\r\n", len(v), string(v)))
-			} else {
-				io.WriteString(conn, "$-1\r\n")
+		if name == "PSYNC" {
+			// PSYNC turns this connection into a long-lived replication
+			// stream; it never returns to ordinary request/response dispatch.
+			serveReplica(db, conn, writer, cmd.Args)
+			return
+		}
+		if cs.sub != nil && cs.sub.subscriptionCount() > 0 && !subscribeModeAllowed[name] {
+			if writer.WriteError("ERR only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT allowed in this context") != nil {
+				return
 			}
-		case "DEL":
-			if len(args) < 2 {
-				io.WriteString(conn, "-ERR wrong number of args for DEL\r\n")
-				continue
+			if writer.Flush() != nil {
+				return
 			}
-			removed := db.Del(args[1:]...)
-			io.WriteString(conn, fmt.Sprintf(":%d\r\n", removed))
-		case "SAVE":
-			if err := db.SaveSnapshot(); err != nil {
-				io.WriteString(conn, "-ERR "+err.Error()+"\r\n")
-			} else {
-				io.WriteString(conn, "+OK\r\n")
+			continue
+		}
+		handler, ok := commandTable[name]
+		if !ok {
+			if writer.WriteError("ERR unknown command '"+cmd.Args[0]+"'") != nil {
+				return
 			}
-		default:
-			io.WriteString(conn, "-ERR unknown command\r\n")
+		} else if handler(db, cs, writer, cmd.Args) != nil {
+			return
+		}
+		if writer.Flush() != nil {
+			return
 		}
 	}
 }
 
-func splitArgs(line string) []string {
-	// very simple splitter; does not support quoted spaces.
-	parts := strings.Fields(line)
-	return parts
-}
-
 func main() {
+	replicaOf := flag.String("replicaof", "", "host:port of a master to replicate from")
+	flag.Parse()
+
 	db, err := NewDB()
 	if err != nil {
 		fmt.Println("failed to start db:", err)
 		return
 	}
+	if *replicaOf != "" {
+		db.StartReplica(*replicaOf)
+	}
 	ln, err := net.Listen("tcp", ADDRESS)
 	if err != nil {
 		fmt.Println("listen error:", err)
@@ -0,0 +1,380 @@
+// pubsub.go
+package main
+
+import (
+	"net"
+	"sync"
+)
+
+// subscriberOutCap is the high-water mark on a subscriber's outbound
+// buffer; a client whose pump can't keep up with publishes is dropped
+// rather than letting it block PUBLISH for everyone else.
+const subscriberOutCap = 256
+
+// subscriber is one connection's pub/sub state: the set of channels and
+// patterns it listens on, and the buffered pump that delivers messages to
+// it without blocking the publisher.
+type subscriber struct {
+	sw       *syncWriter
+	conn     net.Conn
+	out      chan []byte
+	done     chan struct{}
+	dropOnce sync.Once
+
+	mu       sync.Mutex
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+func newSubscriber(conn net.Conn, sw *syncWriter) *subscriber {
+	s := &subscriber{
+		sw:       sw,
+		conn:     conn,
+		out:      make(chan []byte, subscriberOutCap),
+		done:     make(chan struct{}),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+	go s.pump()
+	return s
+}
+
+// pump writes queued deliveries to the connection on its own goroutine, so
+// a slow reader only ever backs up its own channel, never the publisher.
+func (s *subscriber) pump() {
+	for {
+		select {
+		case raw := <-s.out:
+			if _, err := s.sw.Write(raw); err != nil {
+				s.drop()
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// send queues raw for delivery, dropping the subscriber if it's too far
+// behind to keep up.
+func (s *subscriber) send(raw []byte) {
+	select {
+	case s.out <- raw:
+	case <-s.done:
+	default:
+		s.drop()
+	}
+}
+
+func (s *subscriber) drop() {
+	s.dropOnce.Do(func() {
+		close(s.done)
+		s.conn.Close()
+	})
+}
+
+func (s *subscriber) subscriptionCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.channels) + len(s.patterns)
+}
+
+// pubSub is the channel manager shared by all connections: exact channel
+// subscribers keyed by channel name, and pattern subscribers keyed by
+// glob pattern.
+type pubSub struct {
+	mu       sync.Mutex
+	channels map[string]map[*subscriber]struct{}
+	patterns map[string]map[*subscriber]struct{}
+}
+
+func newPubSub() *pubSub {
+	return &pubSub{
+		channels: make(map[string]map[*subscriber]struct{}),
+		patterns: make(map[string]map[*subscriber]struct{}),
+	}
+}
+
+func (ps *pubSub) subscribe(sub *subscriber, channel string) int {
+	ps.mu.Lock()
+	if ps.channels[channel] == nil {
+		ps.channels[channel] = make(map[*subscriber]struct{})
+	}
+	ps.channels[channel][sub] = struct{}{}
+	ps.mu.Unlock()
+
+	sub.mu.Lock()
+	sub.channels[channel] = struct{}{}
+	n := len(sub.channels) + len(sub.patterns)
+	sub.mu.Unlock()
+	return n
+}
+
+func (ps *pubSub) unsubscribe(sub *subscriber, channel string) int {
+	ps.mu.Lock()
+	if set := ps.channels[channel]; set != nil {
+		delete(set, sub)
+		if len(set) == 0 {
+			delete(ps.channels, channel)
+		}
+	}
+	ps.mu.Unlock()
+
+	sub.mu.Lock()
+	delete(sub.channels, channel)
+	n := len(sub.channels) + len(sub.patterns)
+	sub.mu.Unlock()
+	return n
+}
+
+func (ps *pubSub) psubscribe(sub *subscriber, pattern string) int {
+	ps.mu.Lock()
+	if ps.patterns[pattern] == nil {
+		ps.patterns[pattern] = make(map[*subscriber]struct{})
+	}
+	ps.patterns[pattern][sub] = struct{}{}
+	ps.mu.Unlock()
+
+	sub.mu.Lock()
+	sub.patterns[pattern] = struct{}{}
+	n := len(sub.channels) + len(sub.patterns)
+	sub.mu.Unlock()
+	return n
+}
+
+func (ps *pubSub) punsubscribe(sub *subscriber, pattern string) int {
+	ps.mu.Lock()
+	if set := ps.patterns[pattern]; set != nil {
+		delete(set, sub)
+		if len(set) == 0 {
+			delete(ps.patterns, pattern)
+		}
+	}
+	ps.mu.Unlock()
+
+	sub.mu.Lock()
+	delete(sub.patterns, pattern)
+	n := len(sub.channels) + len(sub.patterns)
+	sub.mu.Unlock()
+	return n
+}
+
+// publish fans message out to every exact subscriber of channel (as
+// ["message", channel, message]) and every pattern subscriber whose
+// pattern matches channel (as ["pmessage", pattern, channel, message]),
+// returning the total number of deliveries.
+func (ps *pubSub) publish(channel, message string) int {
+	ps.mu.Lock()
+	var exact []*subscriber
+	for sub := range ps.channels[channel] {
+		exact = append(exact, sub)
+	}
+	type match struct {
+		sub     *subscriber
+		pattern string
+	}
+	var pmatches []match
+	for pattern, subs := range ps.patterns {
+		if !globMatch(pattern, channel) {
+			continue
+		}
+		for sub := range subs {
+			pmatches = append(pmatches, match{sub, pattern})
+		}
+	}
+	ps.mu.Unlock()
+
+	for _, sub := range exact {
+		sub.send(encodeCommand([]string{"message", channel, message}))
+	}
+	for _, pm := range pmatches {
+		pm.sub.send(encodeCommand([]string{"pmessage", pm.pattern, channel, message}))
+	}
+	return len(exact) + len(pmatches)
+}
+
+// globMatch reports whether s matches pattern using Redis-style glob
+// syntax: '*' matches any run of characters, '?' matches exactly one,
+// '[...]' (optionally negated with a leading '^') matches any one
+// character in the class, and '\' escapes the following character.
+func globMatch(pattern, s string) bool {
+	return globMatchBytes([]byte(pattern), []byte(s))
+}
+
+func globMatchBytes(pattern, s []byte) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatchBytes(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			pattern = pattern[1:]
+			negate := false
+			if len(pattern) > 0 && pattern[0] == '^' {
+				negate = true
+				pattern = pattern[1:]
+			}
+			matched := false
+			for len(pattern) > 0 && pattern[0] != ']' {
+				if len(pattern) >= 3 && pattern[1] == '-' {
+					lo, hi := pattern[0], pattern[2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					if s[0] >= lo && s[0] <= hi {
+						matched = true
+					}
+					pattern = pattern[3:]
+				} else {
+					if pattern[0] == s[0] {
+						matched = true
+					}
+					pattern = pattern[1:]
+				}
+			}
+			if len(pattern) > 0 {
+				pattern = pattern[1:] // skip ']'
+			}
+			if matched == negate {
+				return false
+			}
+			s = s[1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+func writeSubAck(w *respWriter, kind, channel string, count int) error {
+	if err := w.WriteArrayHeader(3); err != nil {
+		return err
+	}
+	if err := w.WriteBulkString([]byte(kind)); err != nil {
+		return err
+	}
+	if channel == "" {
+		if err := w.WriteNilBulk(); err != nil {
+			return err
+		}
+	} else if err := w.WriteBulkString([]byte(channel)); err != nil {
+		return err
+	}
+	return w.WriteInteger(int64(count))
+}
+
+func cmdSubscribe(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if len(args) < 2 {
+		return w.WriteError("ERR wrong number of arguments for 'subscribe' command")
+	}
+	if cs.sub == nil {
+		cs.sub = newSubscriber(cs.conn, cs.sw)
+	}
+	for _, ch := range args[1:] {
+		n := db.pubsub.subscribe(cs.sub, ch)
+		if err := writeSubAck(w, "subscribe", ch, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdUnsubscribe(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if cs.sub == nil {
+		cs.sub = newSubscriber(cs.conn, cs.sw)
+	}
+	channels := args[1:]
+	if len(channels) == 0 {
+		cs.sub.mu.Lock()
+		for ch := range cs.sub.channels {
+			channels = append(channels, ch)
+		}
+		cs.sub.mu.Unlock()
+		if len(channels) == 0 {
+			return writeSubAck(w, "unsubscribe", "", 0)
+		}
+	}
+	for _, ch := range channels {
+		n := db.pubsub.unsubscribe(cs.sub, ch)
+		if err := writeSubAck(w, "unsubscribe", ch, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdPSubscribe(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if len(args) < 2 {
+		return w.WriteError("ERR wrong number of arguments for 'psubscribe' command")
+	}
+	if cs.sub == nil {
+		cs.sub = newSubscriber(cs.conn, cs.sw)
+	}
+	for _, p := range args[1:] {
+		n := db.pubsub.psubscribe(cs.sub, p)
+		if err := writeSubAck(w, "psubscribe", p, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdPUnsubscribe(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if cs.sub == nil {
+		cs.sub = newSubscriber(cs.conn, cs.sw)
+	}
+	patterns := args[1:]
+	if len(patterns) == 0 {
+		cs.sub.mu.Lock()
+		for p := range cs.sub.patterns {
+			patterns = append(patterns, p)
+		}
+		cs.sub.mu.Unlock()
+		if len(patterns) == 0 {
+			return writeSubAck(w, "punsubscribe", "", 0)
+		}
+	}
+	for _, p := range patterns {
+		n := db.pubsub.punsubscribe(cs.sub, p)
+		if err := writeSubAck(w, "punsubscribe", p, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdPublish(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if len(args) != 3 {
+		return w.WriteError("ERR wrong number of arguments for 'publish' command")
+	}
+	return w.WriteInteger(int64(db.pubsub.publish(args[1], args[2])))
+}
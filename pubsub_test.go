@@ -0,0 +1,97 @@
+// pubsub_test.go
+package main
+
+import (
+	"bufio"
+	"net"
+	"testing"
+)
+
+// TestPubSubDeliversToExactAndPatternSubscribers subscribes one client to
+// an exact channel and another to a matching glob pattern, publishes from
+// a third connection, and checks both receive their expected push frame.
+func TestPubSubDeliversToExactAndPatternSubscribers(t *testing.T) {
+	db := newTestDB(t)
+
+	exactClient, exactServer := net.Pipe()
+	defer exactClient.Close()
+	go handleConn(exactServer, db)
+
+	patClient, patServer := net.Pipe()
+	defer patClient.Close()
+	go handleConn(patServer, db)
+
+	exactR := bufio.NewReader(exactClient)
+	go exactClient.Write([]byte("*2\r\n$9\r\nSUBSCRIBE\r\n$4\r\nnews\r\n"))
+	wantSubAck := "*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n"
+	if got := readN(t, exactR, len(wantSubAck)); got != wantSubAck {
+		t.Fatalf("subscribe ack: %q, want %q", got, wantSubAck)
+	}
+
+	patR := bufio.NewReader(patClient)
+	go patClient.Write([]byte("*2\r\n$10\r\nPSUBSCRIBE\r\n$5\r\nnews*\r\n"))
+	wantPSubAck := "*3\r\n$10\r\npsubscribe\r\n$5\r\nnews*\r\n:1\r\n"
+	if got := readN(t, patR, len(wantPSubAck)); got != wantPSubAck {
+		t.Fatalf("psubscribe ack: %q, want %q", got, wantPSubAck)
+	}
+
+	waitFor(t, func() bool {
+		return db.pubsub != nil && len(db.pubsub.channels["news"]) == 1 && len(db.pubsub.patterns["news*"]) == 1
+	}, "both subscriptions to register")
+
+	pubClient, pubServer := net.Pipe()
+	defer pubClient.Close()
+	go handleConn(pubServer, db)
+
+	pubR := bufio.NewReader(pubClient)
+	go pubClient.Write([]byte("*3\r\n$7\r\nPUBLISH\r\n$4\r\nnews\r\n$5\r\nhello\r\n"))
+	if line, err := pubR.ReadString('\n'); err != nil || line != ":2\r\n" {
+		t.Fatalf("publish reply: %q, %v", line, err)
+	}
+
+	wantExact := "*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n"
+	gotExact := readN(t, exactR, len(wantExact))
+	if gotExact != wantExact {
+		t.Fatalf("exact subscriber got %q, want %q", gotExact, wantExact)
+	}
+
+	wantPattern := "*4\r\n$8\r\npmessage\r\n$5\r\nnews*\r\n$4\r\nnews\r\n$5\r\nhello\r\n"
+	gotPattern := readN(t, patR, len(wantPattern))
+	if gotPattern != wantPattern {
+		t.Fatalf("pattern subscriber got %q, want %q", gotPattern, wantPattern)
+	}
+}
+
+func readN(t *testing.T, r *bufio.Reader, n int) string {
+	t.Helper()
+	buf := make([]byte, n)
+	if _, err := readFull(r, buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return string(buf)
+}
+
+// TestGlobMatch checks the Redis-style glob subset used to route pattern
+// subscriptions.
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"news.*", "news.tech", true},
+		{"news.*", "news", false},
+		{"news.?", "news.a", true},
+		{"news.?", "news.ab", false},
+		{"h[ae]llo", "hello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"*", "anything", true},
+	}
+	for _, c := range cases {
+		if got := globMatch(c.pattern, c.s); got != c.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", c.pattern, c.s, got, c.want)
+		}
+	}
+}
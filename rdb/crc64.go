@@ -0,0 +1,39 @@
+// crc64.go
+package rdb
+
+// CRC-64/XZ "Jones" variant used by Redis RDB files: reflected input and
+// output, polynomial 0xad93d23594c935a9, zero init, zero xorout.
+const crc64JonesPoly = 0xad93d23594c935a9
+
+var crc64Table [256]uint64
+
+func init() {
+	rev := reverse64(crc64JonesPoly)
+	for i := 0; i < 256; i++ {
+		crc := uint64(i)
+		for j := 0; j < 8; j++ {
+			if crc&1 == 1 {
+				crc = (crc >> 1) ^ rev
+			} else {
+				crc >>= 1
+			}
+		}
+		crc64Table[i] = crc
+	}
+}
+
+func reverse64(x uint64) uint64 {
+	var r uint64
+	for i := 0; i < 64; i++ {
+		r = (r << 1) | (x & 1)
+		x >>= 1
+	}
+	return r
+}
+
+func updateCRC64(crc uint64, data []byte) uint64 {
+	for _, b := range data {
+		crc = crc64Table[byte(crc)^b] ^ (crc >> 8)
+	}
+	return crc
+}
@@ -0,0 +1,8 @@
+// float.go
+package rdb
+
+import "math"
+
+func doubleToBits(f float64) uint64 { return math.Float64bits(f) }
+
+func bitsToDouble(b uint64) float64 { return math.Float64frombits(b) }
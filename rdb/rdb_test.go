@@ -0,0 +1,93 @@
+// rdb_test.go
+package rdb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteReadRoundTrip(t *testing.T) {
+	records := []Record{
+		{Key: "str", Type: TypeString, Value: []byte("hello")},
+		{Key: "str-ttl", Type: TypeString, Value: []byte("bye"), ExpiresAt: 1234567890123},
+		{Key: "list", Type: TypeList, Value: [][]byte{[]byte("a"), []byte("b"), []byte("c")}},
+		{Key: "hash", Type: TypeHash, Value: map[string][]byte{"f1": []byte("v1")}},
+		{Key: "set", Type: TypeSet, Value: map[string]struct{}{"m1": {}, "m2": {}}},
+		{Key: "zset", Type: TypeZSet, Value: ZSetValue{{Member: "m1", Score: 1.5}, {Member: "m2", Score: 2}}},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, records); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got := buf.Bytes()[:len(Magic)]; string(got) != Magic {
+		t.Fatalf("missing magic header, got %q", got)
+	}
+
+	got, err := ReadAll(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if len(got) != len(records) {
+		t.Fatalf("got %d records, want %d", len(got), len(records))
+	}
+	if string(got[0].Value.([]byte)) != "hello" {
+		t.Fatalf("record 0 value = %q", got[0].Value)
+	}
+	if got[1].ExpiresAt != 1234567890123 {
+		t.Fatalf("record 1 expiry = %d", got[1].ExpiresAt)
+	}
+}
+
+// TestTypeTagsMatchRealRedisEnum checks the on-wire type byte against
+// real Redis's RDB_TYPE_* values (string=0, list=1, set=2, zset=3,
+// hash=4), not just against this package's own constants: round-tripping
+// through this package's own reader would pass even if the tags were
+// renumbered arbitrarily, since writer and reader would still agree with
+// each other. A real Redis tool reading one of this package's dumps only
+// decodes correctly if the byte on the wire matches its own enum.
+func TestTypeTagsMatchRealRedisEnum(t *testing.T) {
+	cases := []struct {
+		typ  byte
+		want byte
+	}{
+		{TypeString, 0},
+		{TypeList, 1},
+		{TypeSet, 2},
+		{TypeZSet, 3},
+		{TypeHash, 4},
+	}
+	for _, c := range cases {
+		if c.typ != c.want {
+			t.Errorf("type tag = %d, want %d (real Redis RDB_TYPE_* value)", c.typ, c.want)
+		}
+	}
+
+	var values = map[byte]interface{}{
+		TypeSet:  map[string]struct{}{"m": {}},
+		TypeZSet: ZSetValue{{Member: "m", Score: 1}},
+		TypeHash: map[string][]byte{"f": []byte("v")},
+	}
+	for typ, val := range values {
+		var buf bytes.Buffer
+		if err := Write(&buf, []Record{{Key: "k", Type: typ, Value: val}}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		onWire := buf.Bytes()[len(Magic)]
+		if onWire != typ {
+			t.Fatalf("on-wire type byte = %d, want %d", onWire, typ)
+		}
+	}
+}
+
+func TestReadAllRejectsCorruption(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, []Record{{Key: "k", Type: TypeString, Value: []byte("v")}}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	corrupt := buf.Bytes()
+	corrupt[len(corrupt)-1] ^= 0xFF
+	if _, err := ReadAll(bytes.NewReader(corrupt)); err == nil {
+		t.Fatal("expected checksum mismatch error, got nil")
+	}
+}
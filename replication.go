@@ -0,0 +1,426 @@
+// replication.go
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirdesai22/redisgo/rdb"
+)
+
+// backlogCap bounds the in-memory replication backlog; PSYNC requests for
+// an offset older than the oldest byte still held fall back to FULLRESYNC.
+const backlogCap = 1 << 20 // 1 MiB
+
+// replState tracks this instance's role as a replication master: its
+// identity, write offset, the bounded backlog of serialized writes, and
+// the set of currently attached replica streams.
+type replState struct {
+	mu         sync.Mutex
+	runID      string
+	offset     int64
+	backlog    []byte
+	backlogOff int64 // replication offset corresponding to backlog[0]
+	replicas   map[int]*replicaHandle
+	nextID     int
+}
+
+// replicaHandle is a master-side handle to one connected replica's outbound
+// stream; propagate fans writes out to it without blocking on a slow peer.
+type replicaHandle struct {
+	out      chan []byte
+	done     chan struct{}
+	dropOnce sync.Once
+}
+
+func (h *replicaHandle) drop() {
+	h.dropOnce.Do(func() { close(h.done) })
+}
+
+func newReplState() *replState {
+	return &replState{
+		runID:    randomRunID(),
+		replicas: make(map[int]*replicaHandle),
+	}
+}
+
+func randomRunID() string {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		// fall back to a time-derived id; collisions only matter for PSYNC
+		// continuation, which degrades to a harmless FULLRESYNC.
+		return hex.EncodeToString([]byte(fmt.Sprintf("%040x", time.Now().UnixNano())))
+	}
+	return hex.EncodeToString(b)
+}
+
+// propagate appends a serialized write command to the replication backlog
+// and fans it out to every attached replica. Call after the write has been
+// applied locally.
+func (db *DB) propagate(raw []byte) {
+	rs := db.repl
+	rs.mu.Lock()
+	rs.offset += int64(len(raw))
+	rs.backlog = append(rs.backlog, raw...)
+	if over := len(rs.backlog) - backlogCap; over > 0 {
+		rs.backlog = rs.backlog[over:]
+		rs.backlogOff += int64(over)
+	}
+	handles := make([]*replicaHandle, 0, len(rs.replicas))
+	for _, h := range rs.replicas {
+		handles = append(handles, h)
+	}
+	rs.mu.Unlock()
+
+	for _, h := range handles {
+		select {
+		case h.out <- raw:
+		case <-h.done:
+		default:
+			// replica isn't keeping up; drop it, it will FULLRESYNC next time.
+			h.drop()
+		}
+	}
+}
+
+// serializeForSync encodes the current keyspace as a RESP command log that
+// a freshly attaching replica can replay to catch up: one SET per live
+// string key (with its remaining TTL), and one creation command per
+// collection key.
+func (db *DB) serializeForSync() []byte {
+	now := time.Now()
+	var buf bytes.Buffer
+	db.store.forEach(func(sh *shard) {
+		for k, e := range sh.data {
+			encodeSyncRecord(&buf, now, k, e)
+		}
+	})
+	return buf.Bytes()
+}
+
+// encodeSyncRecord writes the command(s) that recreate one live entry —
+// a SET (with any remaining TTL) for a string, or a single creation
+// command for a collection — into buf. Expired and empty entries write
+// nothing. Shared by serializeForSync and RewriteAOF's snapshot, so both
+// reconstruct the keyspace the same way.
+func encodeSyncRecord(buf *bytes.Buffer, now time.Time, k string, e *entry) {
+	if !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt) {
+		return
+	}
+	if e.Type == rdb.TypeString {
+		args := []string{"SET", k, string(e.Str)}
+		if !e.ExpiresAt.IsZero() {
+			ms := int64(e.ExpiresAt.Sub(now) / time.Millisecond)
+			args = append(args, "PX", strconv.FormatInt(ms, 10))
+		}
+		buf.Write(encodeCommand(args))
+		return
+	}
+	if args := creationCommand(k, e); args != nil {
+		buf.Write(encodeCommand(args))
+	}
+}
+
+// creationCommand returns the single write command that recreates a
+// collection entry from scratch, or nil if it's empty. String entries are
+// handled separately by serializeForSync since they also carry a TTL.
+func creationCommand(key string, e *entry) []string {
+	switch e.Type {
+	case rdb.TypeList:
+		if e.List.Len() == 0 {
+			return nil
+		}
+		args := []string{"RPUSH", key}
+		for n := e.List.Front(); n != nil; n = n.Next() {
+			args = append(args, string(n.Value.([]byte)))
+		}
+		return args
+	case rdb.TypeHash:
+		if len(e.Hash) == 0 {
+			return nil
+		}
+		args := []string{"HSET", key}
+		for f, v := range e.Hash {
+			args = append(args, f, string(v))
+		}
+		return args
+	case rdb.TypeSet:
+		if len(e.Set) == 0 {
+			return nil
+		}
+		args := []string{"SADD", key}
+		for m := range e.Set {
+			args = append(args, m)
+		}
+		return args
+	case rdb.TypeZSet:
+		if e.ZSet.Len() == 0 {
+			return nil
+		}
+		args := []string{"ZADD", key}
+		for _, m := range e.ZSet.RangeByRank(0, -1) {
+			args = append(args, formatScore(m.Score), m.Member)
+		}
+		return args
+	}
+	return nil
+}
+
+// serveReplica handles a PSYNC request: it answers CONTINUE (streaming the
+// buffered backlog tail) when the requested runid/offset are still covered
+// by the backlog, or FULLRESYNC (a fresh snapshot, then live writes)
+// otherwise, and then blocks forwarding the write stream until the replica
+// disconnects.
+func serveReplica(db *DB, conn net.Conn, w *respWriter, args []string) {
+	if len(args) != 3 {
+		w.WriteError("ERR wrong number of arguments for 'psync' command")
+		w.Flush()
+		return
+	}
+	reqRunID := args[1]
+	reqOffset, _ := strconv.ParseInt(args[2], 10, 64)
+
+	rs := db.repl
+	rs.mu.Lock()
+	canContinue := reqRunID == rs.runID && reqOffset >= rs.backlogOff && reqOffset <= rs.offset
+	var tail []byte
+	if canContinue {
+		tail = append([]byte(nil), rs.backlog[reqOffset-rs.backlogOff:]...)
+	}
+	curRunID, curOffset := rs.runID, rs.offset
+	id := rs.nextID
+	rs.nextID++
+	handle := &replicaHandle{out: make(chan []byte, 1024), done: make(chan struct{})}
+	rs.replicas[id] = handle
+	rs.mu.Unlock()
+	defer func() {
+		rs.mu.Lock()
+		delete(rs.replicas, id)
+		rs.mu.Unlock()
+	}()
+
+	conn.SetReadDeadline(time.Time{}) // streaming from here on; no per-command deadline
+
+	if canContinue {
+		if w.WriteRaw([]byte("+CONTINUE\r\n")) != nil || w.Flush() != nil {
+			return
+		}
+		if len(tail) > 0 {
+			if _, err := conn.Write(tail); err != nil {
+				return
+			}
+		}
+	} else {
+		if w.WriteRaw([]byte(fmt.Sprintf("+FULLRESYNC %s %d\r\n", curRunID, curOffset))) != nil {
+			return
+		}
+		snap := db.serializeForSync()
+		if w.WriteBulkHeader(len(snap)) != nil || w.Flush() != nil {
+			return
+		}
+		if _, err := conn.Write(snap); err != nil {
+			return
+		}
+		if _, err := conn.Write(crlf); err != nil {
+			return
+		}
+	}
+
+	for {
+		select {
+		case raw, ok := <-handle.out:
+			if !ok {
+				return
+			}
+			if _, err := conn.Write(raw); err != nil {
+				return
+			}
+		case <-handle.done:
+			return
+		}
+	}
+}
+
+// ApplyReplicated executes a write command streamed from a master (or
+// replayed from the local AOF) directly against the keyspace, bypassing
+// the AOF append and the propagate step: the command is either already on
+// disk (AOF replay) or belongs to an upstream master's stream, so this
+// instance must not re-record or re-propagate it.
+func (db *DB) ApplyReplicated(args []string) {
+	if len(args) == 0 {
+		return
+	}
+	cmd := strings.ToUpper(args[0])
+	if cmd == "DEL" {
+		// The only multi-key command in the replicated set; group by shard
+		// and lock in stable order like the client-facing Del path.
+		for _, g := range db.store.keysByShard(args[1:]) {
+			g.shard.mu.Lock()
+			for _, k := range g.keys {
+				delete(g.shard.data, k)
+			}
+			g.shard.mu.Unlock()
+		}
+		return
+	}
+	if len(args) < 2 {
+		return
+	}
+	sh := db.store.shardFor(args[1])
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	switch cmd {
+	case "SET":
+		if len(args) < 3 {
+			return
+		}
+		var ttl time.Duration
+		if len(args) >= 5 && strings.ToUpper(args[3]) == "PX" {
+			if ms, err := strconv.ParseInt(args[4], 10, 64); err == nil {
+				ttl = time.Duration(ms) * time.Millisecond
+			}
+		}
+		sh.setLocked(args[1], []byte(args[2]), ttl)
+	case "LPUSH":
+		if len(args) >= 3 {
+			sh.lpushLocked(args[1], stringsToBytes(args[2:]))
+		}
+	case "RPUSH":
+		if len(args) >= 3 {
+			sh.rpushLocked(args[1], stringsToBytes(args[2:]))
+		}
+	case "LPOP":
+		if len(args) == 2 {
+			sh.lpopLocked(args[1])
+		}
+	case "RPOP":
+		if len(args) == 2 {
+			sh.rpopLocked(args[1])
+		}
+	case "HSET":
+		if len(args) >= 4 && len(args)%2 == 0 {
+			sh.hsetLocked(args[1], pairsToFields(args[2:]))
+		}
+	case "HDEL":
+		if len(args) >= 3 {
+			sh.hdelLocked(args[1], args[2:])
+		}
+	case "SADD":
+		if len(args) >= 3 {
+			sh.saddLocked(args[1], args[2:])
+		}
+	case "SREM":
+		if len(args) >= 3 {
+			sh.sremLocked(args[1], args[2:])
+		}
+	case "ZADD":
+		if len(args) >= 4 && len(args)%2 == 0 {
+			if members, ok := pairsToZMembers(args[2:]); ok {
+				sh.zaddLocked(args[1], members)
+			}
+		}
+	case "ZREM":
+		if len(args) >= 3 {
+			sh.zremLocked(args[1], args[2:])
+		}
+	}
+}
+
+// StartReplica marks this instance read-only and begins replicating from
+// masterAddr in the background, reconnecting with a PSYNC handshake
+// whenever the connection drops.
+func (db *DB) StartReplica(masterAddr string) {
+	db.readOnly = true
+	go db.replicaLoop(masterAddr)
+}
+
+func (db *DB) replicaLoop(masterAddr string) {
+	for {
+		if err := db.syncWithMaster(masterAddr); err != nil {
+			fmt.Println("replica: lost sync with master, retrying:", err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// syncWithMaster performs one PSYNC handshake and then applies the
+// streamed write log until the connection breaks.
+func (db *DB) syncWithMaster(masterAddr string) error {
+	conn, err := net.Dial("tcp", masterAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	w := newRESPWriter(conn)
+	if w.WriteRaw(encodeCommand([]string{"PSYNC", "?", "-1"})) != nil {
+		return fmt.Errorf("send PSYNC: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	rr := newRESPReader(conn)
+	line, err := rr.readLine()
+	if err != nil {
+		return err
+	}
+	switch {
+	case strings.HasPrefix(line, "+FULLRESYNC"):
+		if err := db.loadFullResync(rr); err != nil {
+			return err
+		}
+	case strings.HasPrefix(line, "+CONTINUE"):
+		// backlog tail streams immediately, same framing as live writes.
+	default:
+		return fmt.Errorf("unexpected PSYNC reply: %q", line)
+	}
+
+	for {
+		cmd, err := rr.ReadCommand()
+		if err != nil {
+			return err
+		}
+		db.ApplyReplicated(cmd.Args)
+	}
+}
+
+func (db *DB) loadFullResync(rr *respReader) error {
+	header, err := rr.readLine()
+	if err != nil {
+		return err
+	}
+	if len(header) == 0 || header[0] != '$' {
+		return fmt.Errorf("malformed snapshot header: %q", header)
+	}
+	n, err := strconv.Atoi(header[1:])
+	if err != nil {
+		return fmt.Errorf("malformed snapshot length: %q", header)
+	}
+	buf := make([]byte, n+2) // payload plus trailing \r\n
+	if _, err := io.ReadFull(rr.r, buf); err != nil {
+		return err
+	}
+
+	db.store.reset()
+
+	snap := newRESPReader(bytes.NewReader(buf[:n]))
+	for {
+		cmd, err := snap.ReadCommand()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		db.ApplyReplicated(cmd.Args)
+	}
+}
@@ -0,0 +1,63 @@
+// replication_test.go
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestReplicationFullResync starts a master and points a replica at it,
+// checking that a key set before the replica attaches arrives via
+// FULLRESYNC and a key set afterwards arrives via the live stream.
+func TestReplicationFullResync(t *testing.T) {
+	master := newTestDB(t)
+	if err := master.Set("existing", []byte("before"), 0); err != nil {
+		t.Fatalf("seed set: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handleConn(conn, master)
+		}
+	}()
+
+	replica := newTestDB(t)
+	replica.StartReplica(ln.Addr().String())
+
+	waitFor(t, func() bool {
+		v, ok, _ := replica.Get("existing")
+		return ok && string(v) == "before"
+	}, "replica to receive snapshot key")
+
+	if err := master.Set("live", []byte("after"), 0); err != nil {
+		t.Fatalf("live set: %v", err)
+	}
+	master.propagate(encodeCommand([]string{"SET", "live", "after"}))
+
+	waitFor(t, func() bool {
+		v, ok, _ := replica.Get("live")
+		return ok && string(v) == "after"
+	}, "replica to receive streamed key")
+}
+
+func waitFor(t *testing.T, cond func() bool, what string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
@@ -0,0 +1,235 @@
+// resp.go
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Command is a single parsed client request: the command name followed by
+// its arguments, exactly as sent (RESP bulk strings or inline-command
+// fields), with no case normalization applied.
+type Command struct {
+	Args []string
+}
+
+// maxMultibulkLen and maxBulkLen bound the multibulk element count and
+// individual bulk-string length a client can claim, matching real Redis's
+// proto-max-bulk-len style guards: without them, a single crafted header
+// like "*999999999999\r\n" drives make() to request a multi-terabyte
+// allocation, which is a fatal (unrecoverable) runtime OOM, not a panic
+// the server can catch and turn into a client error.
+const (
+	maxMultibulkLen = 1024 * 1024
+	maxBulkLen      = 512 * 1024 * 1024
+)
+
+// respReader parses the RESP wire format off a stream. It accepts the
+// array-of-bulk-strings framing real clients use (*<N>\r\n$<len>\r\n<bytes>\r\n...)
+// and falls back to inline commands (a bare line of space-separated
+// fields) for tools like raw telnet.
+type respReader struct {
+	r *bufio.Reader
+}
+
+func newRESPReader(r io.Reader) *respReader {
+	return &respReader{r: bufio.NewReader(r)}
+}
+
+func (rr *respReader) ReadCommand() (*Command, error) {
+	b, err := rr.r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if b[0] == '*' {
+		return rr.readArray()
+	}
+	return rr.readInline()
+}
+
+func (rr *respReader) readLine() (string, error) {
+	line, err := rr.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (rr *respReader) readArray() (*Command, error) {
+	line, err := rr.readLine()
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid multibulk length: %q", line)
+	}
+	if n <= 0 {
+		return &Command{}, nil
+	}
+	if n > maxMultibulkLen {
+		return nil, fmt.Errorf("invalid multibulk length: %q", line)
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		arg, err := rr.readBulk()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return &Command{Args: args}, nil
+}
+
+func (rr *respReader) readBulk() (string, error) {
+	line, err := rr.readLine()
+	if err != nil {
+		return "", err
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return "", fmt.Errorf("expected bulk string, got %q", line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return "", fmt.Errorf("invalid bulk length: %q", line)
+	}
+	if n < 0 {
+		return "", nil
+	}
+	if n > maxBulkLen {
+		return "", fmt.Errorf("invalid bulk length: %q", line)
+	}
+	buf := make([]byte, n+2) // payload plus trailing \r\n
+	if _, err := io.ReadFull(rr.r, buf); err != nil {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
+
+func (rr *respReader) readInline() (*Command, error) {
+	line, err := rr.readLine()
+	if err != nil {
+		return nil, err
+	}
+	return &Command{Args: strings.Fields(line)}, nil
+}
+
+// respWriter encodes RESP2/RESP3 replies onto a buffered stream. Callers
+// must call Flush once a full reply (or batch of pipelined replies) has
+// been written.
+type respWriter struct {
+	w *bufio.Writer
+}
+
+func newRESPWriter(w io.Writer) *respWriter {
+	return &respWriter{w: bufio.NewWriter(w)}
+}
+
+func (rw *respWriter) WriteSimpleString(s string) error {
+	_, err := fmt.Fprintf(rw.w, "+%s\r\n", s)
+	return err
+}
+
+func (rw *respWriter) WriteError(msg string) error {
+	_, err := fmt.Fprintf(rw.w, "-%s\r\n", msg)
+	return err
+}
+
+func (rw *respWriter) WriteInteger(n int64) error {
+	_, err := fmt.Fprintf(rw.w, ":%d\r\n", n)
+	return err
+}
+
+func (rw *respWriter) WriteBulkString(b []byte) error {
+	if _, err := fmt.Fprintf(rw.w, "$%d\r\n", len(b)); err != nil {
+		return err
+	}
+	if _, err := rw.w.Write(b); err != nil {
+		return err
+	}
+	_, err := rw.w.Write(crlf)
+	return err
+}
+
+func (rw *respWriter) WriteNilBulk() error {
+	_, err := rw.w.Write(nilBulk)
+	return err
+}
+
+func (rw *respWriter) WriteArrayHeader(n int) error {
+	_, err := fmt.Fprintf(rw.w, "*%d\r\n", n)
+	return err
+}
+
+// WriteMap writes a RESP3 map (%N) when proto is 3, falling back to a flat
+// RESP2 array of alternating key/value bulk strings for older clients.
+func (rw *respWriter) WriteMap(pairs [][2]string, proto int) error {
+	if proto >= 3 {
+		if _, err := fmt.Fprintf(rw.w, "%%%d\r\n", len(pairs)); err != nil {
+			return err
+		}
+	} else if err := rw.WriteArrayHeader(len(pairs) * 2); err != nil {
+		return err
+	}
+	for _, kv := range pairs {
+		if err := rw.WriteBulkString([]byte(kv[0])); err != nil {
+			return err
+		}
+		if err := rw.WriteBulkString([]byte(kv[1])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rw *respWriter) Flush() error {
+	return rw.w.Flush()
+}
+
+// WriteRaw writes pre-encoded RESP bytes verbatim, for replies (like the
+// PSYNC handshake lines) that don't fit the typed helpers above.
+func (rw *respWriter) WriteRaw(b []byte) error {
+	_, err := rw.w.Write(b)
+	return err
+}
+
+// WriteBulkHeader writes a bulk string length header without its payload,
+// for callers that stream the payload directly onto the connection.
+func (rw *respWriter) WriteBulkHeader(n int) error {
+	_, err := fmt.Fprintf(rw.w, "$%d\r\n", n)
+	return err
+}
+
+// encodeCommand serializes a command as a RESP array of bulk strings, the
+// framing used both for client requests and for the replication stream.
+func encodeCommand(args []string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	return []byte(b.String())
+}
+
+var (
+	crlf    = []byte("\r\n")
+	nilBulk = []byte("$-1\r\n")
+)
+
+// syncWriter serializes writes to an underlying connection so that the
+// per-command reply path and an independent push path (pub/sub deliveries)
+// can share one net.Conn without interleaving partial writes.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
@@ -0,0 +1,121 @@
+// resp_test.go
+package main
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newTestDB returns a DB backed by a scratch AOF file in t.TempDir so tests
+// don't pollute or depend on the process's working-directory AOF.
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	dir := t.TempDir()
+	aofPath := dir + "/appendonly.aof"
+	f, err := os.OpenFile(aofPath, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("open aof: %v", err)
+	}
+	db := &DB{store: newShardedStore(4), aof: f, repl: newReplState(), pubsub: newPubSub()}
+	return db
+}
+
+// TestPipelining sends several commands back to back in a single write and
+// verifies all replies come back in order, proving the RESP reader doesn't
+// need a round trip per command.
+func TestPipelining(t *testing.T) {
+	db := newTestDB(t)
+	client, server := net.Pipe()
+	defer client.Close()
+	go handleConn(server, db)
+
+	req := "" +
+		"*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n" +
+		"*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$1\r\n2\r\n" +
+		"*2\r\n$3\r\nGET\r\n$1\r\na\r\n" +
+		"*2\r\n$3\r\nGET\r\n$1\r\nb\r\n" +
+		"*2\r\n$3\r\nDEL\r\n$1\r\na\r\n" +
+		"*1\r\n$4\r\nPING\r\n"
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Write([]byte(req))
+		done <- err
+	}()
+	if err := <-done; err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	r := bufio.NewReader(client)
+	want := []string{
+		"+OK\r\n",
+		"+OK\r\n",
+		"$1\r\n1\r\n",
+		"$1\r\n2\r\n",
+		":1\r\n",
+		"+PONG\r\n",
+	}
+	for i, w := range want {
+		buf := make([]byte, len(w))
+		if _, err := readFull(r, buf); err != nil {
+			t.Fatalf("reply %d: read: %v", i, err)
+		}
+		if got := string(buf); got != w {
+			t.Fatalf("reply %d: got %q, want %q", i, got, w)
+		}
+	}
+}
+
+func readFull(r *bufio.Reader, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// TestReadArrayRejectsOversizedMultibulk checks that a claimed multibulk
+// count past maxMultibulkLen is rejected before any allocation, rather
+// than trusting the client-supplied length.
+func TestReadArrayRejectsOversizedMultibulk(t *testing.T) {
+	rr := newRESPReader(strings.NewReader("*999999999999\r\n"))
+	if _, err := rr.ReadCommand(); err == nil {
+		t.Fatal("expected an error for an oversized multibulk count, got nil")
+	}
+}
+
+// TestReadBulkRejectsOversizedLength checks that a claimed bulk-string
+// length past maxBulkLen is rejected before any allocation.
+func TestReadBulkRejectsOversizedLength(t *testing.T) {
+	rr := newRESPReader(strings.NewReader("*1\r\n$999999999999\r\n"))
+	if _, err := rr.ReadCommand(); err == nil {
+		t.Fatal("expected an error for an oversized bulk length, got nil")
+	}
+}
+
+// TestHelloUpgradesProto checks that HELLO 3 switches the connection's
+// reply encoding to a RESP3 map for subsequent map-shaped replies.
+func TestHelloUpgradesProto(t *testing.T) {
+	db := newTestDB(t)
+	client, server := net.Pipe()
+	defer client.Close()
+	go handleConn(server, db)
+
+	go client.Write([]byte("*2\r\n$5\r\nHELLO\r\n$1\r\n3\r\n"))
+
+	r := bufio.NewReader(client)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if line[0] != '%' {
+		t.Fatalf("expected RESP3 map header, got %q", line)
+	}
+}
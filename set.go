@@ -0,0 +1,193 @@
+// set.go
+package main
+
+import "github.com/sirdesai22/redisgo/rdb"
+
+func (sh *shard) saddLocked(key string, members []string) (int, error) {
+	e, err := sh.getOrCreateLocked(key, rdb.TypeSet, func() *entry {
+		return &entry{Type: rdb.TypeSet, Set: make(map[string]struct{})}
+	})
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for _, m := range members {
+		if _, exists := e.Set[m]; !exists {
+			e.Set[m] = struct{}{}
+			added++
+		}
+	}
+	return added, nil
+}
+
+func (sh *shard) sremLocked(key string, members []string) (int, error) {
+	e, ok := sh.data[key]
+	if !ok {
+		return 0, nil
+	}
+	if e.Type != rdb.TypeSet {
+		return 0, errWrongType
+	}
+	removed := 0
+	for _, m := range members {
+		if _, exists := e.Set[m]; exists {
+			delete(e.Set, m)
+			removed++
+		}
+	}
+	if len(e.Set) == 0 {
+		delete(sh.data, key)
+	}
+	return removed, nil
+}
+
+// SAdd adds members to key's set (creating it if absent) and returns the
+// number of members that were newly added.
+func (db *DB) SAdd(key string, members ...string) (int, error) {
+	raw := encodeCommand(append([]string{"SADD", key}, members...))
+
+	sh := db.store.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	n, err := sh.saddLocked(key, members)
+	if err != nil {
+		return 0, err
+	}
+	return n, db.logAndPropagate(raw)
+}
+
+// SRem removes members from key's set.
+func (db *DB) SRem(key string, members ...string) (int, error) {
+	raw := encodeCommand(append([]string{"SREM", key}, members...))
+
+	sh := db.store.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	n, err := sh.sremLocked(key, members)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	return n, db.logAndPropagate(raw)
+}
+
+// SIsMember reports whether member is in key's set.
+func (db *DB) SIsMember(key, member string) (bool, error) {
+	sh := db.store.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	e, ok := sh.data[key]
+	if !ok {
+		return false, nil
+	}
+	if e.Type != rdb.TypeSet {
+		return false, errWrongType
+	}
+	_, exists := e.Set[member]
+	return exists, nil
+}
+
+// SMembers returns all members of key's set.
+func (db *DB) SMembers(key string) ([]string, error) {
+	sh := db.store.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	e, ok := sh.data[key]
+	if !ok {
+		return nil, nil
+	}
+	if e.Type != rdb.TypeSet {
+		return nil, errWrongType
+	}
+	out := make([]string, 0, len(e.Set))
+	for m := range e.Set {
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// SCard returns the number of members in key's set.
+func (db *DB) SCard(key string) (int, error) {
+	sh := db.store.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	e, ok := sh.data[key]
+	if !ok {
+		return 0, nil
+	}
+	if e.Type != rdb.TypeSet {
+		return 0, errWrongType
+	}
+	return len(e.Set), nil
+}
+
+func cmdSAdd(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if db.readOnly {
+		return w.WriteError("READONLY You can't write against a read only replica.")
+	}
+	if len(args) < 3 {
+		return w.WriteError("ERR wrong number of arguments for 'sadd' command")
+	}
+	n, err := db.SAdd(args[1], args[2:]...)
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	return w.WriteInteger(int64(n))
+}
+
+func cmdSRem(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if db.readOnly {
+		return w.WriteError("READONLY You can't write against a read only replica.")
+	}
+	if len(args) < 3 {
+		return w.WriteError("ERR wrong number of arguments for 'srem' command")
+	}
+	n, err := db.SRem(args[1], args[2:]...)
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	return w.WriteInteger(int64(n))
+}
+
+func cmdSIsMember(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if len(args) != 3 {
+		return w.WriteError("ERR wrong number of arguments for 'sismember' command")
+	}
+	ok, err := db.SIsMember(args[1], args[2])
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	if ok {
+		return w.WriteInteger(1)
+	}
+	return w.WriteInteger(0)
+}
+
+func cmdSMembers(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if len(args) != 2 {
+		return w.WriteError("ERR wrong number of arguments for 'smembers' command")
+	}
+	members, err := db.SMembers(args[1])
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	if err := w.WriteArrayHeader(len(members)); err != nil {
+		return err
+	}
+	for _, m := range members {
+		if err := w.WriteBulkString([]byte(m)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdSCard(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if len(args) != 2 {
+		return w.WriteError("ERR wrong number of arguments for 'scard' command")
+	}
+	n, err := db.SCard(args[1])
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	return w.WriteInteger(int64(n))
+}
@@ -0,0 +1,170 @@
+// sharding.go
+package main
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirdesai22/redisgo/xxhash"
+)
+
+// shardRingSize is the number of precomputed ring buckets shardIndexFor
+// routes through. Must be a power of two so bucket lookup is a mask, not
+// a division. 4096 keeps per-shard bucket counts (and thus routing skew)
+// low even at the largest shard counts we run with.
+const shardRingSize = 4096
+
+// shard owns a disjoint slice of the keyspace: its own map and its own
+// lock, so reads/writes against unrelated keys never contend.
+type shard struct {
+	mu   sync.RWMutex
+	data map[string]*entry
+}
+
+// shardedStore splits the keyspace across a fixed number of shards.
+// Shard ownership is assigned by rendezvous (highest random weight)
+// hashing over a fixed ring of shardRingSize buckets, computed once at
+// construction: each shard has a fixed seed, and bucket b belongs to
+// whichever shard's seed mixes with it into the largest hash. Unlike
+// modulo hashing, growing the shard count only remaps the buckets that
+// move, not the whole keyspace. A key is routed by hashing it straight
+// to a bucket (and from there, via the precomputed ring, to a shard),
+// so the hot path is one hash plus an array lookup rather than an HRW
+// scan over every shard on every call.
+type shardedStore struct {
+	shards []*shard
+	ring   []int
+}
+
+func newShardedStore(n int) *shardedStore {
+	if n < 1 {
+		n = 1
+	}
+	s := &shardedStore{
+		shards: make([]*shard, n),
+		ring:   make([]int, shardRingSize),
+	}
+	seeds := make([]uint64, n)
+	for i := range s.shards {
+		s.shards[i] = &shard{data: make(map[string]*entry)}
+		// Seeds only need to differ per shard so each one mixes the same
+		// bucket hash into a different point in the range; derived from
+		// the shard index rather than randomized so shard assignment is
+		// reproducible from one run to the next.
+		seeds[i] = xxhash.Sum64String("redisgo-shard", uint64(i)+1)
+	}
+	for b := 0; b < shardRingSize; b++ {
+		best := 0
+		var bestScore uint64
+		bucketKey := strconv.Itoa(b)
+		for i, seed := range seeds {
+			score := xxhash.Sum64String(bucketKey, seed)
+			if i == 0 || score > bestScore {
+				bestScore = score
+				best = i
+			}
+		}
+		s.ring[b] = best
+	}
+	return s
+}
+
+// shardFor picks key's shard via the precomputed rendezvous ring.
+func (s *shardedStore) shardFor(key string) *shard {
+	return s.shards[s.shardIndexFor(key)]
+}
+
+// shardIndexFor hashes key to a ring bucket and looks up that bucket's
+// owning shard. O(1): one xxhash plus a mask and an array index, versus
+// the O(numShards) it would cost to score every shard's seed per call.
+func (s *shardedStore) shardIndexFor(key string) int {
+	bucket := xxhash.Sum64String(key, 0) & (shardRingSize - 1)
+	return s.ring[bucket]
+}
+
+// keysByShard groups keys by the shard they hash to, returned in a
+// stable shard-index order so callers that lock every group in sequence
+// never deadlock against another multi-key command over overlapping keys.
+type shardGroup struct {
+	shard *shard
+	index int
+	keys  []string
+}
+
+func (s *shardedStore) keysByShard(keys []string) []shardGroup {
+	byIndex := make(map[int]*shardGroup)
+	for _, k := range keys {
+		idx := s.shardIndexFor(k)
+		g, ok := byIndex[idx]
+		if !ok {
+			g = &shardGroup{shard: s.shards[idx], index: idx}
+			byIndex[idx] = g
+		}
+		g.keys = append(g.keys, k)
+	}
+	groups := make([]shardGroup, 0, len(byIndex))
+	for _, g := range byIndex {
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].index < groups[j].index })
+	return groups
+}
+
+// forEach runs fn against every shard in index order, holding its read
+// lock for the duration of fn. Used for operations (snapshot, serialize)
+// that scan the whole keyspace without needing a single consistent view
+// across shards.
+func (s *shardedStore) forEach(fn func(sh *shard)) {
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		fn(sh)
+		sh.mu.RUnlock()
+	}
+}
+
+// withAllLocked holds every shard's read lock for the duration of fn,
+// locking them in ascending index order (the same order every multi-shard
+// caller uses, so this can never deadlock against one of them). Unlike
+// forEach, which only guarantees fn sees a consistent view of one shard
+// at a time, this guarantees no write lands on *any* shard while fn runs
+// — for scans that must be atomic with a state transition writers also
+// observe, such as arming AOF-rewrite diff capture against the exact
+// point the snapshot was read from.
+func (s *shardedStore) withAllLocked(fn func()) {
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+	}
+	fn()
+	for _, sh := range s.shards {
+		sh.mu.RUnlock()
+	}
+}
+
+// reset empties every shard, used when a replica discards its dataset to
+// load a fresh FULLRESYNC snapshot.
+func (s *shardedStore) reset() {
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		sh.data = make(map[string]*entry)
+		sh.mu.Unlock()
+	}
+}
+
+// expireLoop periodically sweeps this shard's own keys for expiry,
+// independent of every other shard's ticker.
+func (sh *shard) expireLoop() {
+	t := time.NewTicker(EXPIRY_TICK)
+	defer t.Stop()
+	for range t.C {
+		now := time.Now()
+		sh.mu.Lock()
+		for k, e := range sh.data {
+			if !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt) {
+				delete(sh.data, k)
+			}
+		}
+		sh.mu.Unlock()
+	}
+}
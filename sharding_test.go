@@ -0,0 +1,78 @@
+// sharding_test.go
+package main
+
+import "testing"
+
+// TestShardForIsStable checks that the same key always routes to the
+// same shard, and that keys spread across more than one shard.
+func TestShardForIsStable(t *testing.T) {
+	s := newShardedStore(8)
+	keys := []string{"a", "b", "c", "d", "user:1", "user:2", "order:99"}
+	first := make(map[string]int, len(keys))
+	for _, k := range keys {
+		first[k] = s.shardIndexFor(k)
+	}
+	for i := 0; i < 10; i++ {
+		for _, k := range keys {
+			if got := s.shardIndexFor(k); got != first[k] {
+				t.Fatalf("shardIndexFor(%q) changed between calls: %d != %d", k, got, first[k])
+			}
+		}
+	}
+
+	seen := make(map[int]bool)
+	for _, idx := range first {
+		seen[idx] = true
+	}
+	if len(seen) < 2 {
+		t.Fatalf("all keys routed to the same shard: %v", first)
+	}
+}
+
+// TestKeysByShardGroupsAndOrders checks that keysByShard groups every key
+// under its own shard's index and returns groups in ascending index order.
+func TestKeysByShardGroupsAndOrders(t *testing.T) {
+	s := newShardedStore(4)
+	keys := []string{"alpha", "beta", "gamma", "delta", "epsilon"}
+	groups := s.keysByShard(keys)
+
+	seen := make(map[string]bool)
+	last := -1
+	for _, g := range groups {
+		if g.index <= last {
+			t.Fatalf("groups not in ascending index order: %d after %d", g.index, last)
+		}
+		last = g.index
+		for _, k := range g.keys {
+			if s.shardIndexFor(k) != g.index {
+				t.Fatalf("key %q grouped under shard %d, want %d", k, g.index, s.shardIndexFor(k))
+			}
+			seen[k] = true
+		}
+	}
+	for _, k := range keys {
+		if !seen[k] {
+			t.Fatalf("key %q missing from grouped output", k)
+		}
+	}
+}
+
+// TestDelAcrossShards checks that DB.Del removes keys regardless of which
+// shard they land on.
+func TestDelAcrossShards(t *testing.T) {
+	db := newTestDB(t)
+	keys := []string{"k1", "k2", "k3", "k4", "k5", "k6"}
+	for _, k := range keys {
+		if err := db.Set(k, []byte("v"), 0); err != nil {
+			t.Fatalf("set %q: %v", k, err)
+		}
+	}
+	if n := db.Del(keys...); n != len(keys) {
+		t.Fatalf("del = %d, want %d", n, len(keys))
+	}
+	for _, k := range keys {
+		if _, ok, _ := db.Get(k); ok {
+			t.Fatalf("key %q still present after del", k)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Package xxhash implements the 64-bit xxHash algorithm (xxh64), used
+// here purely as a fast, well-distributed mixing function for rendezvous
+// hashing over shards. It is not exposed for cryptographic use.
+package xxhash
+
+const (
+	prime1 uint64 = 11400714785074694791
+	prime2 uint64 = 14029467366897019727
+	prime3 uint64 = 1609587929392839161
+	prime4 uint64 = 9650029242287828579
+	prime5 uint64 = 2870177450012600261
+)
+
+// Sum64 returns the xxh64 digest of b, seeded with seed.
+func Sum64(b []byte, seed uint64) uint64 {
+	var h uint64
+	n := len(b)
+
+	if n >= 32 {
+		v1 := seed + prime1 + prime2
+		v2 := seed + prime2
+		v3 := seed
+		v4 := seed - prime1
+
+		for len(b) >= 32 {
+			v1 = round(v1, le64(b[0:8]))
+			v2 = round(v2, le64(b[8:16]))
+			v3 = round(v3, le64(b[16:24]))
+			v4 = round(v4, le64(b[24:32]))
+			b = b[32:]
+		}
+
+		h = rotl(v1, 1) + rotl(v2, 7) + rotl(v3, 12) + rotl(v4, 18)
+		h = mergeRound(h, v1)
+		h = mergeRound(h, v2)
+		h = mergeRound(h, v3)
+		h = mergeRound(h, v4)
+	} else {
+		h = seed + prime5
+	}
+
+	h += uint64(n)
+
+	for len(b) >= 8 {
+		h ^= round(0, le64(b[0:8]))
+		h = rotl(h, 27)*prime1 + prime4
+		b = b[8:]
+	}
+	if len(b) >= 4 {
+		h ^= uint64(le32(b[0:4])) * prime1
+		h = rotl(h, 23)*prime2 + prime3
+		b = b[4:]
+	}
+	for len(b) > 0 {
+		h ^= uint64(b[0]) * prime5
+		h = rotl(h, 11) * prime1
+		b = b[1:]
+	}
+
+	h ^= h >> 33
+	h *= prime2
+	h ^= h >> 29
+	h *= prime3
+	h ^= h >> 32
+
+	return h
+}
+
+// Sum64String is Sum64 over the bytes of s, as a convenience for callers
+// hashing a string key (the []byte(s) conversion still copies).
+func Sum64String(s string, seed uint64) uint64 {
+	return Sum64([]byte(s), seed)
+}
+
+func round(acc, input uint64) uint64 {
+	acc += input * prime2
+	acc = rotl(acc, 31)
+	acc *= prime1
+	return acc
+}
+
+func mergeRound(acc, val uint64) uint64 {
+	val = round(0, val)
+	acc ^= val
+	acc = acc*prime1 + prime4
+	return acc
+}
+
+func rotl(x uint64, r uint) uint64 {
+	return (x << r) | (x >> (64 - r))
+}
+
+func le64(b []byte) uint64 {
+	return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 | uint64(b[3])<<24 |
+		uint64(b[4])<<32 | uint64(b[5])<<40 | uint64(b[6])<<48 | uint64(b[7])<<56
+}
+
+func le32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
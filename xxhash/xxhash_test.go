@@ -0,0 +1,34 @@
+package xxhash
+
+import "testing"
+
+// TestSum64KnownVectors checks against the reference xxh64 test vectors
+// for the empty string and a short literal, seeded with 0.
+func TestSum64KnownVectors(t *testing.T) {
+	cases := []struct {
+		in   string
+		seed uint64
+		want uint64
+	}{
+		{"", 0, 0xef46db3751d8e999},
+		{"a", 0, 0xd24ec4f1a98c6e5b},
+	}
+	for _, c := range cases {
+		if got := Sum64String(c.in, c.seed); got != c.want {
+			t.Errorf("Sum64String(%q, %d) = %#x, want %#x", c.in, c.seed, got, c.want)
+		}
+	}
+}
+
+// TestSum64Deterministic checks that the same input always hashes the
+// same, and that different seeds spread the same key across the range.
+func TestSum64Deterministic(t *testing.T) {
+	a := Sum64String("shard-key", 1)
+	b := Sum64String("shard-key", 1)
+	if a != b {
+		t.Fatalf("Sum64String not deterministic: %d != %d", a, b)
+	}
+	if Sum64String("shard-key", 1) == Sum64String("shard-key", 2) {
+		t.Fatalf("different seeds collided for the same key")
+	}
+}
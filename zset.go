@@ -0,0 +1,489 @@
+// zset.go
+package main
+
+import (
+	"strconv"
+
+	"github.com/sirdesai22/redisgo/rdb"
+)
+
+const zskiplistMaxLevel = 32
+const zskiplistP = 0.25
+
+// ZMember is one (member, score) pair of a sorted set, as returned by
+// range queries.
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+type zskipNode struct {
+	member   string
+	score    float64
+	backward *zskipNode
+	level    []zskipLevel
+}
+
+type zskipLevel struct {
+	forward *zskipNode
+	span    int
+}
+
+// zskiplist is a classic Redis-style skiplist: nodes are ordered by
+// (score, member), and each level's span lets getByRank answer rank
+// queries in O(log N) without an auxiliary index.
+type zskiplist struct {
+	header *zskipNode
+	tail   *zskipNode
+	length int
+	level  int
+	rand   uint64 // xorshift state for zslRandomLevel, seeded lazily
+}
+
+func newZSkiplist() *zskiplist {
+	return &zskiplist{
+		header: &zskipNode{level: make([]zskipLevel, zskiplistMaxLevel)},
+		level:  1,
+		rand:   0x2545F4914F6CDD1D, // arbitrary fixed seed; level choice need not be cryptographic
+	}
+}
+
+// zslRandomLevel picks a node's level with P(level i) = zskiplistP^(i-1),
+// matching Redis's t_zset.c.
+func (zsl *zskiplist) zslRandomLevel() int {
+	zsl.rand ^= zsl.rand << 13
+	zsl.rand ^= zsl.rand >> 7
+	zsl.rand ^= zsl.rand << 17
+	level := 1
+	for float64(zsl.rand&0xffff)/0xffff < zskiplistP && level < zskiplistMaxLevel {
+		level++
+		zsl.rand ^= zsl.rand << 13
+		zsl.rand ^= zsl.rand >> 7
+		zsl.rand ^= zsl.rand << 17
+	}
+	return level
+}
+
+func (zsl *zskiplist) insert(member string, score float64) {
+	var update [zskiplistMaxLevel]*zskipNode
+	var rank [zskiplistMaxLevel]int
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		if i == zsl.level-1 {
+			rank[i] = 0
+		} else {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.score < score ||
+				(x.level[i].forward.score == score && x.level[i].forward.member < member)) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := zsl.zslRandomLevel()
+	if level > zsl.level {
+		for i := zsl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = zsl.header
+			update[i].level[i].span = zsl.length
+		}
+		zsl.level = level
+	}
+
+	node := &zskipNode{member: member, score: score, level: make([]zskipLevel, level)}
+	for i := 0; i < level; i++ {
+		node.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = node
+		node.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < zsl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] == zsl.header {
+		node.backward = nil
+	} else {
+		node.backward = update[0]
+	}
+	if node.level[0].forward != nil {
+		node.level[0].forward.backward = node
+	} else {
+		zsl.tail = node
+	}
+	zsl.length++
+}
+
+func (zsl *zskiplist) delete(member string, score float64) bool {
+	var update [zskiplistMaxLevel]*zskipNode
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.score < score ||
+				(x.level[i].forward.score == score && x.level[i].forward.member < member)) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	x = x.level[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+	for i := 0; i < zsl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+	for zsl.level > 1 && zsl.header.level[zsl.level-1].forward == nil {
+		zsl.level--
+	}
+	zsl.length--
+	return true
+}
+
+// getByRank returns the node at 0-based rank, or nil if out of range.
+func (zsl *zskiplist) getByRank(rank int) *zskipNode {
+	if rank < 0 || rank >= zsl.length {
+		return nil
+	}
+	x := zsl.header
+	traversed := -1
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+// firstInRange returns the first node with score >= min, or nil.
+func (zsl *zskiplist) firstInRange(min float64) *zskipNode {
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.score < min {
+			x = x.level[i].forward
+		}
+	}
+	return x.level[0].forward
+}
+
+// zset is the in-memory representation of a Redis sorted set: a skiplist
+// for ordered rank/range access plus a member->score map for O(1) ZSCORE.
+// Like list, hash, and set, it has no internal lock of its own — callers
+// must hold the owning shard's lock for the duration of any access.
+type zset struct {
+	skip   *zskiplist
+	scores map[string]float64
+}
+
+func newZSet() *zset {
+	return &zset{skip: newZSkiplist(), scores: make(map[string]float64)}
+}
+
+// Add inserts or updates members, returning how many were newly added
+// (as opposed to re-scored).
+func (z *zset) Add(members []ZMember) int {
+	added := 0
+	for _, m := range members {
+		if old, exists := z.scores[m.Member]; exists {
+			if old == m.Score {
+				continue
+			}
+			z.skip.delete(m.Member, old)
+			z.skip.insert(m.Member, m.Score)
+			z.scores[m.Member] = m.Score
+			continue
+		}
+		z.skip.insert(m.Member, m.Score)
+		z.scores[m.Member] = m.Score
+		added++
+	}
+	return added
+}
+
+// Rem removes members, returning how many were present.
+func (z *zset) Rem(members []string) int {
+	removed := 0
+	for _, m := range members {
+		if score, exists := z.scores[m]; exists {
+			z.skip.delete(m, score)
+			delete(z.scores, m)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Score returns member's score.
+func (z *zset) Score(member string) (float64, bool) {
+	s, ok := z.scores[member]
+	return s, ok
+}
+
+// Len returns the number of members.
+func (z *zset) Len() int {
+	return z.skip.length
+}
+
+// RangeByRank returns members with 0-based ranks in [start, stop]
+// (negative indices count from the end), ordered by score.
+func (z *zset) RangeByRank(start, stop int) []ZMember {
+	n := z.skip.length
+	start, stop = normalizeRange(start, stop, n)
+	if start > stop || n == 0 {
+		return nil
+	}
+	out := make([]ZMember, 0, stop-start+1)
+	node := z.skip.getByRank(start)
+	for i := start; i <= stop && node != nil; i, node = i+1, node.level[0].forward {
+		out = append(out, ZMember{Member: node.member, Score: node.score})
+	}
+	return out
+}
+
+// RangeByScore returns members with score in [min, max], ordered by score.
+func (z *zset) RangeByScore(min, max float64) []ZMember {
+	var out []ZMember
+	for node := z.skip.firstInRange(min); node != nil && node.score <= max; node = node.level[0].forward {
+		out = append(out, ZMember{Member: node.member, Score: node.score})
+	}
+	return out
+}
+
+func (sh *shard) zaddLocked(key string, members []ZMember) (int, error) {
+	e, err := sh.getOrCreateLocked(key, rdb.TypeZSet, func() *entry {
+		return &entry{Type: rdb.TypeZSet, ZSet: newZSet()}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return e.ZSet.Add(members), nil
+}
+
+func (sh *shard) zremLocked(key string, members []string) (int, error) {
+	e, ok := sh.data[key]
+	if !ok {
+		return 0, nil
+	}
+	if e.Type != rdb.TypeZSet {
+		return 0, errWrongType
+	}
+	n := e.ZSet.Rem(members)
+	if e.ZSet.Len() == 0 {
+		delete(sh.data, key)
+	}
+	return n, nil
+}
+
+// ZAdd adds or updates members in key's sorted set (creating it if
+// absent) and returns the number of members newly added.
+func (db *DB) ZAdd(key string, members ...ZMember) (int, error) {
+	args := []string{"ZADD", key}
+	for _, m := range members {
+		args = append(args, formatScore(m.Score), m.Member)
+	}
+	raw := encodeCommand(args)
+
+	sh := db.store.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	n, err := sh.zaddLocked(key, members)
+	if err != nil {
+		return 0, err
+	}
+	return n, db.logAndPropagate(raw)
+}
+
+// ZRem removes members from key's sorted set.
+func (db *DB) ZRem(key string, members ...string) (int, error) {
+	raw := encodeCommand(append([]string{"ZREM", key}, members...))
+
+	sh := db.store.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	n, err := sh.zremLocked(key, members)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	return n, db.logAndPropagate(raw)
+}
+
+// ZScore returns member's score in key's sorted set.
+func (db *DB) ZScore(key, member string) (float64, bool, error) {
+	sh := db.store.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	e, ok := sh.data[key]
+	if !ok {
+		return 0, false, nil
+	}
+	if e.Type != rdb.TypeZSet {
+		return 0, false, errWrongType
+	}
+	s, ok := e.ZSet.Score(member)
+	return s, ok, nil
+}
+
+// ZRange returns members of key's sorted set with ranks in [start, stop].
+func (db *DB) ZRange(key string, start, stop int) ([]ZMember, error) {
+	sh := db.store.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	e, ok := sh.data[key]
+	if !ok {
+		return nil, nil
+	}
+	if e.Type != rdb.TypeZSet {
+		return nil, errWrongType
+	}
+	return e.ZSet.RangeByRank(start, stop), nil
+}
+
+// ZRangeByScore returns members of key's sorted set with score in
+// [min, max].
+func (db *DB) ZRangeByScore(key string, min, max float64) ([]ZMember, error) {
+	sh := db.store.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	e, ok := sh.data[key]
+	if !ok {
+		return nil, nil
+	}
+	if e.Type != rdb.TypeZSet {
+		return nil, errWrongType
+	}
+	return e.ZSet.RangeByScore(min, max), nil
+}
+
+// formatScore renders a score the way ZADD/ZRANGE commands expect to see
+// it on the wire: the shortest representation that round-trips exactly.
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
+
+// pairsToZMembers turns a flat [score1 member1 score2 member2 ...]
+// argument list into ZMembers, as used by ZADD. ok is false if any score
+// fails to parse.
+func pairsToZMembers(pairs []string) ([]ZMember, bool) {
+	members := make([]ZMember, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		score, err := strconv.ParseFloat(pairs[i], 64)
+		if err != nil {
+			return nil, false
+		}
+		members = append(members, ZMember{Member: pairs[i+1], Score: score})
+	}
+	return members, true
+}
+
+func cmdZAdd(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if db.readOnly {
+		return w.WriteError("READONLY You can't write against a read only replica.")
+	}
+	if len(args) < 4 || len(args)%2 != 0 {
+		return w.WriteError("ERR wrong number of arguments for 'zadd' command")
+	}
+	members, ok := pairsToZMembers(args[2:])
+	if !ok {
+		return w.WriteError("ERR value is not a valid float")
+	}
+	n, err := db.ZAdd(args[1], members...)
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	return w.WriteInteger(int64(n))
+}
+
+func cmdZRem(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if db.readOnly {
+		return w.WriteError("READONLY You can't write against a read only replica.")
+	}
+	if len(args) < 3 {
+		return w.WriteError("ERR wrong number of arguments for 'zrem' command")
+	}
+	n, err := db.ZRem(args[1], args[2:]...)
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	return w.WriteInteger(int64(n))
+}
+
+func cmdZScore(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if len(args) != 3 {
+		return w.WriteError("ERR wrong number of arguments for 'zscore' command")
+	}
+	score, ok, err := db.ZScore(args[1], args[2])
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	if !ok {
+		return w.WriteNilBulk()
+	}
+	return w.WriteBulkString([]byte(formatScore(score)))
+}
+
+func cmdZRange(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if len(args) != 4 {
+		return w.WriteError("ERR wrong number of arguments for 'zrange' command")
+	}
+	start, err1 := parseInt(args[2])
+	stop, err2 := parseInt(args[3])
+	if err1 != nil || err2 != nil {
+		return w.WriteError("ERR value is not an integer or out of range")
+	}
+	members, err := db.ZRange(args[1], start, stop)
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	return writeZMembers(w, members)
+}
+
+func cmdZRangeByScore(db *DB, cs *clientState, w *respWriter, args []string) error {
+	if len(args) != 4 {
+		return w.WriteError("ERR wrong number of arguments for 'zrangebyscore' command")
+	}
+	min, err1 := strconv.ParseFloat(args[2], 64)
+	max, err2 := strconv.ParseFloat(args[3], 64)
+	if err1 != nil || err2 != nil {
+		return w.WriteError("ERR min or max is not a float")
+	}
+	members, err := db.ZRangeByScore(args[1], min, max)
+	if err != nil {
+		return w.WriteError(err.Error())
+	}
+	return writeZMembers(w, members)
+}
+
+// writeZMembers writes a flat [member1 score1 member2 score2 ...] array
+// reply, as ZRANGE/ZRANGEBYSCORE return without WITHSCORES in most
+// clients' wire format.
+func writeZMembers(w *respWriter, members []ZMember) error {
+	if err := w.WriteArrayHeader(len(members) * 2); err != nil {
+		return err
+	}
+	for _, m := range members {
+		if err := w.WriteBulkString([]byte(m.Member)); err != nil {
+			return err
+		}
+		if err := w.WriteBulkString([]byte(formatScore(m.Score))); err != nil {
+			return err
+		}
+	}
+	return nil
+}